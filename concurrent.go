@@ -0,0 +1,108 @@
+package orderedset
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentOrderedSet is a goroutine-safe ordered set whose membership is kept in a sync.Map,
+// so that Has never locks and Add and Remove on different elements rarely contend. It suits
+// workloads dominated by membership checks with few reads of the order.
+//
+// The order is kept in a separate append-only log. Remove only deletes the membership entry,
+// leaving a tombstone in the log, and Values drops the tombstones while it walks the log
+// under a lock. Values is therefore considerably more expensive than on an OrderedSet.
+// Remove also compacts the log once tombstones outnumber the elements, so the log holds at
+// most about twice as many entries as the set, at the cost of an occasional Remove walking it.
+type ConcurrentOrderedSet[T comparable] struct {
+	members    sync.Map
+	size       atomic.Int64
+	tombstones atomic.Int64
+
+	mu  sync.Mutex
+	log []logEntry[T]
+}
+
+// logEntry records an insertion into a ConcurrentOrderedSet. The entry is live while the
+// value's membership entry still holds token.
+type logEntry[T comparable] struct {
+	value T
+	token *logToken
+}
+
+// logToken identifies an insertion. It is not zero-sized, so that distinct tokens never
+// share an address.
+type logToken struct{ _ byte }
+
+// NewConcurrent creates a new empty ConcurrentOrderedSet.
+func NewConcurrent[T comparable]() *ConcurrentOrderedSet[T] {
+	return &ConcurrentOrderedSet[T]{}
+}
+
+// Add inserts a value into the set if it is not already present.
+func (s *ConcurrentOrderedSet[T]) Add(value T) {
+	token := &logToken{}
+	if _, loaded := s.members.LoadOrStore(value, token); loaded {
+		return
+	}
+	s.size.Add(1)
+	s.mu.Lock()
+	s.log = append(s.log, logEntry[T]{value: value, token: token})
+	s.mu.Unlock()
+}
+
+// Remove deletes a value from the set.
+func (s *ConcurrentOrderedSet[T]) Remove(value T) {
+	if _, loaded := s.members.LoadAndDelete(value); !loaded {
+		return
+	}
+	size := s.size.Add(-1)
+	if s.tombstones.Add(1) <= size {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tombstones.Load() > s.size.Load() {
+		s.compact()
+	}
+}
+
+// Has reports whether the set contains the given value.
+func (s *ConcurrentOrderedSet[T]) Has(value T) bool {
+	_, exists := s.members.Load(value)
+	return exists
+}
+
+// Len returns the number of elements in the set.
+func (s *ConcurrentOrderedSet[T]) Len() int {
+	return int(s.size.Load())
+}
+
+// Values returns the values in insertion order, compacting the log of insertions on the way.
+// It costs a membership lookup for every log entry, live or tombstone, and blocks Add while
+// it runs.
+func (s *ConcurrentOrderedSet[T]) Values() []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compact()
+
+	values := make([]T, len(s.log))
+	for i, e := range s.log {
+		values[i] = e.value
+	}
+	return values
+}
+
+// compact drops the tombstones from the log of insertions.
+// The caller must hold s.mu.
+func (s *ConcurrentOrderedSet[T]) compact() {
+	live := s.log[:0]
+	for _, e := range s.log {
+		if token, exists := s.members.Load(e.value); exists && token == e.token {
+			live = append(live, e)
+		}
+	}
+	s.tombstones.Add(-int64(len(s.log) - len(live)))
+	clear(s.log[len(live):])
+	s.log = live
+}
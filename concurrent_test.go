@@ -0,0 +1,106 @@
+package orderedset_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/babenkoivan/orderedset"
+)
+
+func TestNewConcurrent(t *testing.T) {
+	s := orderedset.NewConcurrent[int]()
+	for _, v := range []int{1, 2, 3, 2, 4} {
+		s.Add(v)
+	}
+	s.Remove(2)
+	s.Remove(9)
+	s.Add(2)
+
+	expected := []int{1, 3, 4, 2}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("NewConcurrent failed: got %v, want %v", s.Values(), expected)
+	}
+	if s.Len() != 4 || !s.Has(2) || s.Has(9) {
+		t.Errorf("NewConcurrent failed: got length %d, want 4", s.Len())
+	}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Values failed: got %v after compaction, want %v", s.Values(), expected)
+	}
+}
+
+func TestConcurrentRemoveCompactsLog(t *testing.T) {
+	s := orderedset.NewConcurrent[int]()
+	s.Add(-1)
+	s.Add(-2)
+	for i := range 1000 {
+		s.Add(i)
+		s.Remove(i)
+	}
+
+	if n := orderedset.LogLen(s); n > 2*s.Len()+1 {
+		t.Errorf("Remove failed: got %d log entries for %d elements", n, s.Len())
+	}
+	if expected := []int{-1, -2}; !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Remove failed: got %v, want %v", s.Values(), expected)
+	}
+}
+
+func TestConcurrentOrderedSetConcurrent(t *testing.T) {
+	s := orderedset.NewConcurrent[int]()
+
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 250 {
+				v := g*250 + i
+				s.Add(v)
+				s.Has(v)
+				if i%2 == 1 {
+					s.Remove(v)
+				}
+				if i%50 == 0 {
+					s.Values()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if l := len(s.Values()); l != 500 || s.Len() != 500 {
+		t.Errorf("ConcurrentOrderedSet failed: got %d values and length %d, want 500", l, s.Len())
+	}
+}
+
+func BenchmarkConcurrentHas(b *testing.B) {
+	plain := orderedset.New[int]()
+	concurrent := orderedset.NewConcurrent[int]()
+	for i := range 4096 {
+		plain.Add(i)
+		concurrent.Add(i)
+	}
+
+	for n, set := range map[string]interface {
+		Add(int)
+		Has(int) bool
+	}{
+		"OrderedSet":           plain,
+		"ConcurrentOrderedSet": concurrent,
+	} {
+		b.Run(n, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					if i%64 == 0 {
+						set.Add(i % 8192)
+					} else {
+						set.Has(i % 8192)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
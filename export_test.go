@@ -0,0 +1,27 @@
+package orderedset
+
+import (
+	"maps"
+	"slices"
+)
+
+// InjectDuplicate appends value to the set's values without updating its index.
+func InjectDuplicate[T comparable](s *OrderedSet[T], value T) {
+	s.lock()
+	defer s.unlock()
+	s.values = append(s.values, value)
+}
+
+// HandleKeys returns the keys under which the set keeps the handles of interned elements.
+func HandleKeys[T comparable](s *OrderedSet[T]) []T {
+	s.rlock()
+	defer s.runlock()
+	return slices.Collect(maps.Keys(s.handles))
+}
+
+// LogLen returns the number of entries, live or tombstone, in the set's log of insertions.
+func LogLen[T comparable](s *ConcurrentOrderedSet[T]) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.log)
+}
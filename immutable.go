@@ -0,0 +1,162 @@
+package orderedset
+
+import (
+	"iter"
+	"maps"
+	"sync/atomic"
+)
+
+// foldThreshold is the number of elements an ImmutableOrderedSet tracks outside its shared
+// base index before With builds a new base.
+const foldThreshold = 32
+
+// ImmutableOrderedSet is an ordered set that is never modified once created. With and Without
+// return new sets instead of changing the receiver, so an ImmutableOrderedSet can be shared
+// between goroutines without locking.
+//
+// Sets derived with With share storage with the set they were derived from: the values are
+// appended in place when no other set has claimed the next slot of the backing array, and
+// the index is split into a shared base and a small private map of appended elements.
+// Without copies the set.
+type ImmutableOrderedSet[T comparable] struct {
+	values []T
+	used   *atomic.Int64
+	base   map[T]int
+	extra  map[T]int
+}
+
+// NewImmutable creates an ImmutableOrderedSet holding the given values, in order,
+// skipping duplicates.
+func NewImmutable[T comparable](values ...T) *ImmutableOrderedSet[T] {
+	index := make(map[T]int, len(values))
+	unique := make([]T, 0, len(values))
+	for _, v := range values {
+		if _, exists := index[v]; !exists {
+			index[v] = len(unique)
+			unique = append(unique, v)
+		}
+	}
+	return newImmutable(unique, index)
+}
+
+// Freeze returns an ImmutableOrderedSet holding a snapshot of the set's elements.
+func (s *OrderedSet[T]) Freeze() *ImmutableOrderedSet[T] {
+	s.rlock()
+	defer s.runlock()
+	values := make([]T, len(s.values))
+	copy(values, s.values)
+	index := make(map[T]int, len(values))
+	for i, v := range values {
+		index[v] = i
+	}
+	return newImmutable(values, index)
+}
+
+// newImmutable returns an ImmutableOrderedSet that owns values and index.
+func newImmutable[T comparable](values []T, index map[T]int) *ImmutableOrderedSet[T] {
+	used := new(atomic.Int64)
+	used.Store(int64(len(values)))
+	return &ImmutableOrderedSet[T]{values: values, used: used, base: index}
+}
+
+// With returns a set holding the elements of s followed by value. If value is already
+// present, s itself is returned.
+func (s *ImmutableOrderedSet[T]) With(value T) *ImmutableOrderedSet[T] {
+	if s.Has(value) {
+		return s
+	}
+	n := len(s.values)
+	result := &ImmutableOrderedSet[T]{base: s.base}
+	if s.used != nil && n < cap(s.values) && s.used.CompareAndSwap(int64(n), int64(n+1)) {
+		result.values = append(s.values, value)
+		result.used = s.used
+	} else {
+		result.values = append(s.values[:n:n], value)
+		result.used = new(atomic.Int64)
+		result.used.Store(int64(n + 1))
+	}
+
+	if len(s.extra) < foldThreshold {
+		result.extra = make(map[T]int, len(s.extra)+1)
+		maps.Copy(result.extra, s.extra)
+		result.extra[value] = n
+		return result
+	}
+	result.base = make(map[T]int, n+1)
+	maps.Copy(result.base, s.base)
+	maps.Copy(result.base, s.extra)
+	result.base[value] = n
+	return result
+}
+
+// Without returns a set holding the elements of s except value, in order. If value is not
+// present, s itself is returned.
+func (s *ImmutableOrderedSet[T]) Without(value T) *ImmutableOrderedSet[T] {
+	i, exists := s.pos(value)
+	if !exists {
+		return s
+	}
+	values := make([]T, 0, len(s.values)-1)
+	values = append(values, s.values[:i]...)
+	values = append(values, s.values[i+1:]...)
+	index := make(map[T]int, len(values))
+	for j, v := range values {
+		index[v] = j
+	}
+	return newImmutable(values, index)
+}
+
+// pos returns the position of value in the set.
+func (s *ImmutableOrderedSet[T]) pos(value T) (int, bool) {
+	if i, exists := s.extra[value]; exists {
+		return i, true
+	}
+	i, exists := s.base[value]
+	return i, exists
+}
+
+// Has reports whether the set contains the given value.
+func (s *ImmutableOrderedSet[T]) Has(value T) bool {
+	_, exists := s.pos(value)
+	return exists
+}
+
+// Len returns the number of elements in the set.
+func (s *ImmutableOrderedSet[T]) Len() int {
+	return len(s.values)
+}
+
+// At returns the element at the given index.
+func (s *ImmutableOrderedSet[T]) At(index int) (T, bool) {
+	if index < 0 || index >= len(s.values) {
+		var zero T
+		return zero, false
+	}
+	return s.values[index], true
+}
+
+// IndexOf returns the index of the given value, or -1 if not found.
+func (s *ImmutableOrderedSet[T]) IndexOf(value T) int {
+	if i, exists := s.pos(value); exists {
+		return i
+	}
+	return -1
+}
+
+// Values returns a copy of the values in insertion order.
+func (s *ImmutableOrderedSet[T]) Values() []T {
+	valuesCopy := make([]T, len(s.values))
+	copy(valuesCopy, s.values)
+	return valuesCopy
+}
+
+// Enumerate returns an iterator over index-value pairs in insertion order.
+func (s *ImmutableOrderedSet[T]) Enumerate() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		for i, v := range s.values {
+			if !yield(i, v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package orderedset_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/babenkoivan/orderedset"
+)
+
+func TestImmutableOrderedSet(t *testing.T) {
+	s := orderedset.NewImmutable(1, 2, 2, 3)
+
+	added := s.With(4)
+	removed := s.Without(2)
+	if !reflect.DeepEqual(s.Values(), []int{1, 2, 3}) || s.Has(4) {
+		t.Errorf("ImmutableOrderedSet failed: original modified, got %v", s.Values())
+	}
+	if !reflect.DeepEqual(added.Values(), []int{1, 2, 3, 4}) || added.IndexOf(4) != 3 {
+		t.Errorf("With failed: got %v, want [1 2 3 4]", added.Values())
+	}
+	if !reflect.DeepEqual(removed.Values(), []int{1, 3}) || removed.IndexOf(3) != 1 || removed.Has(2) {
+		t.Errorf("Without failed: got %v, want [1 3]", removed.Values())
+	}
+	if s.With(2) != s || s.Without(5) != s {
+		t.Error("ImmutableOrderedSet failed: expected no-op changes to return the receiver")
+	}
+}
+
+func TestImmutableOrderedSetSharing(t *testing.T) {
+	s := orderedset.NewImmutable[int]()
+	for i := range 100 {
+		s = s.With(i)
+	}
+
+	left := s.With(-1).With(-2)
+	right := s.With(-3)
+	if left.Has(-3) || right.Has(-1) || right.Has(-2) {
+		t.Error("ImmutableOrderedSet failed: membership leaked between sets sharing storage")
+	}
+	if l, _ := left.At(100); l != -1 {
+		t.Errorf("With failed: got %d at index 100, want -1", l)
+	}
+	if r, _ := right.At(100); r != -3 {
+		t.Errorf("With failed: got %d at index 100, want -3", r)
+	}
+	if s.Len() != 100 || s.IndexOf(99) != 99 {
+		t.Errorf("ImmutableOrderedSet failed: original modified, got length %d", s.Len())
+	}
+
+	frozen := orderedset.New(orderedset.WithInitial(1, 2)).Freeze()
+	if !reflect.DeepEqual(frozen.With(3).Values(), []int{1, 2, 3}) {
+		t.Errorf("Freeze failed: got %v, want [1 2 3]", frozen.With(3).Values())
+	}
+}
+
+func TestImmutableOrderedSetConcurrent(t *testing.T) {
+	s := orderedset.NewImmutable(1, 2, 3).With(4)
+
+	results := make([]*orderedset.ImmutableOrderedSet[int], 8)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.With(10 + i)
+		}()
+	}
+	wg.Wait()
+
+	for i, r := range results {
+		expected := []int{1, 2, 3, 4, 10 + i}
+		if !reflect.DeepEqual(r.Values(), expected) {
+			t.Errorf("With failed: got %v, want %v", r.Values(), expected)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package orderedset
+
+import "sync"
+
+// KeyedOrderedSet is a generic set that preserves insertion order and determines
+// membership by a key computed from each element rather than by element equality.
+type KeyedOrderedSet[T any, K comparable] struct {
+	mu     sync.RWMutex
+	keyFn  func(T) K
+	index  map[K]int
+	values []T
+}
+
+// NewBy creates a new empty KeyedOrderedSet that identifies elements by keyFn.
+func NewBy[T any, K comparable](keyFn func(T) K) *KeyedOrderedSet[T, K] {
+	return &KeyedOrderedSet[T, K]{
+		keyFn:  keyFn,
+		index:  make(map[K]int),
+		values: make([]T, 0),
+	}
+}
+
+// NewPtrSet creates a new empty KeyedOrderedSet of pointers that identifies elements by
+// keyFn applied to each pointer. Returning the dereferenced value, or a field of it, from
+// keyFn makes distinct pointers to equal values collapse to a single entry.
+func NewPtrSet[T any, K comparable](keyFn func(*T) K) *KeyedOrderedSet[*T, K] {
+	return NewBy(keyFn)
+}
+
+// Add inserts a value into the set if no element with the same key is present.
+func (s *KeyedOrderedSet[T, K]) Add(value T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.keyFn(value)
+	if _, exists := s.index[key]; !exists {
+		s.index[key] = len(s.values)
+		s.values = append(s.values, value)
+	}
+}
+
+// GetOrAdd returns the stored element sharing value's key with loaded true if there is one,
+// and otherwise adds value and returns it with loaded false.
+func (s *KeyedOrderedSet[T, K]) GetOrAdd(value T) (stored T, loaded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.keyFn(value)
+	if i, exists := s.index[key]; exists {
+		return s.values[i], true
+	}
+	s.index[key] = len(s.values)
+	s.values = append(s.values, value)
+	return value, false
+}
+
+// MergeWith adds the elements of other in order, and for each element whose key is already
+// present, replaces the existing element in place with resolve(existing, incoming). resolve
+// must return an element with the same key, and the existing element is kept when it does
+// not. resolve is called under the write lock, so it must not use the set. The elements of
+// other are taken before the set is locked.
+func (s *KeyedOrderedSet[T, K]) MergeWith(other *KeyedOrderedSet[T, K], resolve func(existing, incoming T) T) {
+	incoming := other.Values()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range incoming {
+		key := s.keyFn(v)
+		if i, exists := s.index[key]; exists {
+			if resolved := resolve(s.values[i], v); s.keyFn(resolved) == key {
+				s.values[i] = resolved
+			}
+			continue
+		}
+		s.index[key] = len(s.values)
+		s.values = append(s.values, v)
+	}
+}
+
+// Remove deletes the element sharing value's key from the set.
+func (s *KeyedOrderedSet[T, K]) Remove(value T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, exists := s.index[s.keyFn(value)]; exists {
+		s.removeAt(i)
+	}
+}
+
+// RemoveAt deletes a value by index and returns it. If index is invalid, ok is false.
+func (s *KeyedOrderedSet[T, K]) RemoveAt(index int) (val T, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index < 0 || index >= len(s.values) {
+		var zero T
+		return zero, false
+	}
+	val = s.values[index]
+	s.removeAt(index)
+	return val, true
+}
+
+// removeAt deletes the element at index and shifts the positions of the following elements.
+// The caller must hold the write lock.
+func (s *KeyedOrderedSet[T, K]) removeAt(index int) {
+	delete(s.index, s.keyFn(s.values[index]))
+	s.values = append(s.values[:index], s.values[index+1:]...)
+	for i := index; i < len(s.values); i++ {
+		s.index[s.keyFn(s.values[i])] = i
+	}
+}
+
+// Has reports whether the set contains an element with the same key as value.
+func (s *KeyedOrderedSet[T, K]) Has(value T) bool {
+	return s.HasKey(s.keyFn(value))
+}
+
+// HasKey reports whether the set contains an element with the given key.
+func (s *KeyedOrderedSet[T, K]) HasKey(key K) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.index[key]
+	return exists
+}
+
+// Get returns the stored element with the given key.
+func (s *KeyedOrderedSet[T, K]) Get(key K) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i, exists := s.index[key]; exists {
+		return s.values[i], true
+	}
+	var zero T
+	return zero, false
+}
+
+// Len returns the number of elements in the set.
+func (s *KeyedOrderedSet[T, K]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.values)
+}
+
+// Values returns a copy of the values in insertion order.
+func (s *KeyedOrderedSet[T, K]) Values() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	valuesCopy := make([]T, len(s.values))
+	copy(valuesCopy, s.values)
+	return valuesCopy
+}
+
+// At returns the element at the given index.
+func (s *KeyedOrderedSet[T, K]) At(index int) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if index < 0 || index >= len(s.values) {
+		var zero T
+		return zero, false
+	}
+	return s.values[index], true
+}
+
+// IndexOf returns the index of the element sharing value's key, or -1 if not found.
+func (s *KeyedOrderedSet[T, K]) IndexOf(value T) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i, exists := s.index[s.keyFn(value)]; exists {
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,141 @@
+package orderedset_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/babenkoivan/orderedset"
+)
+
+type user struct {
+	ID   int
+	Name string
+}
+
+func userID(u user) int { return u.ID }
+
+func TestNewBy(t *testing.T) {
+	s := orderedset.NewBy(userID)
+	s.Add(user{ID: 1, Name: "alice"})
+	s.Add(user{ID: 2, Name: "bob"})
+	s.Add(user{ID: 1, Name: "alicia"})
+
+	expected := []user{{ID: 1, Name: "alice"}, {ID: 2, Name: "bob"}}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("NewBy failed: got %v, want %v", s.Values(), expected)
+	}
+
+	if !s.Has(user{ID: 1, Name: "someone else"}) {
+		t.Error("NewBy failed: expected Has to match by key")
+	}
+
+	got, ok := s.Get(1)
+	if !ok || got.Name != "alice" {
+		t.Errorf("Get failed: got (%v, %v), want (alice, true)", got, ok)
+	}
+}
+
+func TestKeyedGetOrAdd(t *testing.T) {
+	s := orderedset.NewBy(userID)
+
+	stored, loaded := s.GetOrAdd(user{ID: 1, Name: "alice"})
+	if loaded || stored.Name != "alice" {
+		t.Errorf("GetOrAdd failed: got (%v, %v), want (alice, false)", stored, loaded)
+	}
+	stored, loaded = s.GetOrAdd(user{ID: 1, Name: "alicia"})
+	if !loaded || stored.Name != "alice" {
+		t.Errorf("GetOrAdd failed: got (%v, %v), want the first-inserted alice and true", stored, loaded)
+	}
+	if s.Len() != 1 {
+		t.Errorf("GetOrAdd failed: got length %d, want 1", s.Len())
+	}
+}
+
+func TestKeyedMergeWith(t *testing.T) {
+	type record struct {
+		ID      int
+		Version int
+	}
+	recordID := func(r record) int { return r.ID }
+	newer := func(existing, incoming record) record {
+		if incoming.Version > existing.Version {
+			return incoming
+		}
+		return existing
+	}
+
+	s := orderedset.NewBy(recordID)
+	s.Add(record{ID: 1, Version: 2})
+	s.Add(record{ID: 2, Version: 1})
+	other := orderedset.NewBy(recordID)
+	other.Add(record{ID: 3, Version: 1})
+	other.Add(record{ID: 2, Version: 3})
+	other.Add(record{ID: 1, Version: 1})
+
+	s.MergeWith(other, newer)
+	expected := []record{{ID: 1, Version: 2}, {ID: 2, Version: 3}, {ID: 3, Version: 1}}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("MergeWith failed: got %v, want %v", s.Values(), expected)
+	}
+	if idx := s.IndexOf(record{ID: 3}); idx != 2 {
+		t.Errorf("MergeWith failed: IndexOf(3) got %d, want 2", idx)
+	}
+
+	s.MergeWith(other, func(existing, incoming record) record {
+		return record{ID: existing.ID + 10, Version: 9}
+	})
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("MergeWith failed: got %v, want %v when resolve changes the key", s.Values(), expected)
+	}
+	if s.HasKey(11) || s.IndexOf(record{ID: 1}) != 0 {
+		t.Error("MergeWith failed: expected the index to keep the original keys")
+	}
+}
+
+func TestKeyedRemove(t *testing.T) {
+	s := orderedset.NewBy(userID)
+	s.Add(user{ID: 1, Name: "alice"})
+	s.Add(user{ID: 2, Name: "bob"})
+	s.Add(user{ID: 3, Name: "carol"})
+
+	s.Remove(user{ID: 1})
+	if s.HasKey(1) {
+		t.Error("Remove failed: key 1 should be removed")
+	}
+	if idx := s.IndexOf(user{ID: 3}); idx != 1 {
+		t.Errorf("Remove failed: IndexOf(3) got %d, want 1", idx)
+	}
+
+	val, ok := s.RemoveAt(0)
+	if !ok || val.ID != 2 {
+		t.Errorf("RemoveAt failed: got (%v, %v), want (bob, true)", val, ok)
+	}
+	if s.Len() != 1 {
+		t.Errorf("RemoveAt failed: got length %d, want 1", s.Len())
+	}
+}
+
+func TestNewPtrSet(t *testing.T) {
+	type node struct {
+		Name string
+	}
+
+	a := &node{Name: "a"}
+	alsoA := &node{Name: "a"}
+	b := &node{Name: "b"}
+
+	s := orderedset.NewPtrSet(func(n *node) node { return *n })
+	s.Add(a)
+	s.Add(alsoA)
+	s.Add(b)
+
+	if l := s.Len(); l != 2 {
+		t.Errorf("NewPtrSet failed: got length %d, want 2", l)
+	}
+	if got, _ := s.At(0); got != a {
+		t.Error("NewPtrSet failed: expected the first pointer to be kept")
+	}
+	if !s.Has(alsoA) {
+		t.Error("NewPtrSet failed: expected Has to match an equal value through another pointer")
+	}
+}
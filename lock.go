@@ -0,0 +1,319 @@
+package orderedset
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// rwLocker is the locking interface used by OrderedSet.
+type rwLocker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// contextLocker is an rwLocker whose acquisition can be abandoned when a context is done.
+type contextLocker interface {
+	rwLocker
+	LockContext(ctx context.Context) error
+	RLockContext(ctx context.Context) error
+}
+
+// chanRWMutex is a reader/writer lock whose acquisition can be cancelled with a context.
+// Waiters are woken by closing a channel whenever the lock state changes. New readers
+// wait while a writer is pending, so that writers are not starved.
+type chanRWMutex struct {
+	mu      sync.Mutex
+	readers int
+	writer  bool
+	pending int
+	wake    chan struct{}
+}
+
+// waitCh returns the channel closed on the next state change. The caller must hold m.mu.
+func (m *chanRWMutex) waitCh() <-chan struct{} {
+	if m.wake == nil {
+		m.wake = make(chan struct{})
+	}
+	return m.wake
+}
+
+// broadcast wakes all waiters. The caller must hold m.mu.
+func (m *chanRWMutex) broadcast() {
+	if m.wake != nil {
+		close(m.wake)
+		m.wake = nil
+	}
+}
+
+// LockContext acquires the write lock, or returns ctx.Err() if ctx is done first.
+func (m *chanRWMutex) LockContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.pending++
+	for m.writer || m.readers > 0 {
+		wake := m.waitCh()
+		m.mu.Unlock()
+		select {
+		case <-wake:
+			m.mu.Lock()
+		case <-ctx.Done():
+			m.mu.Lock()
+			m.pending--
+			m.broadcast()
+			m.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	m.pending--
+	m.writer = true
+	m.mu.Unlock()
+	return nil
+}
+
+// RLockContext acquires the read lock, or returns ctx.Err() if ctx is done first.
+func (m *chanRWMutex) RLockContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	for m.writer || m.pending > 0 {
+		wake := m.waitCh()
+		m.mu.Unlock()
+		select {
+		case <-wake:
+			m.mu.Lock()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	m.readers++
+	m.mu.Unlock()
+	return nil
+}
+
+// Lock acquires the write lock.
+func (m *chanRWMutex) Lock() {
+	_ = m.LockContext(context.Background())
+}
+
+// Unlock releases the write lock.
+func (m *chanRWMutex) Unlock() {
+	m.mu.Lock()
+	m.writer = false
+	m.broadcast()
+	m.mu.Unlock()
+}
+
+// RLock acquires the read lock.
+func (m *chanRWMutex) RLock() {
+	_ = m.RLockContext(context.Background())
+}
+
+// RUnlock releases the read lock.
+func (m *chanRWMutex) RUnlock() {
+	m.mu.Lock()
+	m.readers--
+	if m.readers == 0 {
+		m.broadcast()
+	}
+	m.mu.Unlock()
+}
+
+// LockStats describes how a set created with NewInstrumented has used its lock.
+type LockStats struct {
+	// Acquisitions is the number of times the lock was acquired, for reading or writing.
+	Acquisitions int64
+	// Contended is the number of acquisitions that had to wait for the lock.
+	Contended int64
+	// HoldTime is the total time the lock was held, either for writing or by at least one reader.
+	HoldTime time.Duration
+}
+
+// instrumentedRWMutex is a sync.RWMutex that records LockStats. Contention is detected by a
+// failed TryLock or TryRLock before blocking.
+type instrumentedRWMutex struct {
+	rw sync.RWMutex
+
+	mu        sync.Mutex
+	stats     LockStats
+	readers   int
+	heldSince time.Time
+}
+
+// Lock acquires the write lock.
+func (m *instrumentedRWMutex) Lock() {
+	contended := !m.rw.TryLock()
+	if contended {
+		m.rw.Lock()
+	}
+	m.mu.Lock()
+	m.record(contended)
+	m.heldSince = time.Now()
+	m.mu.Unlock()
+}
+
+// Unlock releases the write lock.
+func (m *instrumentedRWMutex) Unlock() {
+	m.mu.Lock()
+	m.stats.HoldTime += time.Since(m.heldSince)
+	m.mu.Unlock()
+	m.rw.Unlock()
+}
+
+// RLock acquires the read lock.
+func (m *instrumentedRWMutex) RLock() {
+	contended := !m.rw.TryRLock()
+	if contended {
+		m.rw.RLock()
+	}
+	m.mu.Lock()
+	m.record(contended)
+	if m.readers == 0 {
+		m.heldSince = time.Now()
+	}
+	m.readers++
+	m.mu.Unlock()
+}
+
+// RUnlock releases the read lock.
+func (m *instrumentedRWMutex) RUnlock() {
+	m.mu.Lock()
+	m.readers--
+	if m.readers == 0 {
+		m.stats.HoldTime += time.Since(m.heldSince)
+	}
+	m.mu.Unlock()
+	m.rw.RUnlock()
+}
+
+// record counts an acquisition. The caller must hold m.mu.
+func (m *instrumentedRWMutex) record(contended bool) {
+	m.stats.Acquisitions++
+	if contended {
+		m.stats.Contended++
+	}
+}
+
+// Stats returns the lock statistics of a set created with NewInstrumented.
+// Other sets do not record statistics and return zero LockStats.
+func (s *OrderedSet[T]) Stats() LockStats {
+	m, ok := s.lk.(*instrumentedRWMutex)
+	if !ok {
+		return LockStats{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// lock acquires the set's write lock, and removes the expired elements of a set created
+// with NewExpiring.
+func (s *OrderedSet[T]) lock() {
+	if s.lk != nil {
+		s.lk.Lock()
+	} else {
+		s.mu.Lock()
+	}
+	s.purge()
+}
+
+// unlock releases the set's write lock.
+func (s *OrderedSet[T]) unlock() {
+	if s.lk != nil {
+		s.lk.Unlock()
+		return
+	}
+	s.mu.Unlock()
+}
+
+// rlock acquires the set's read lock. On a set created with NewExpiring, it first removes the
+// expired elements under the write lock.
+func (s *OrderedSet[T]) rlock() {
+	if s.ttl > 0 {
+		s.lock()
+		s.unlock()
+	}
+	if s.lk != nil {
+		s.lk.RLock()
+		return
+	}
+	s.mu.RLock()
+}
+
+// runlock releases the set's read lock.
+func (s *OrderedSet[T]) runlock() {
+	if s.lk != nil {
+		s.lk.RUnlock()
+		return
+	}
+	s.mu.RUnlock()
+}
+
+// rlockContext acquires the set's read lock, giving up when ctx is done if the set was
+// created with NewContextAware. Other sets can only honor a context that is already done.
+func (s *OrderedSet[T]) rlockContext(ctx context.Context) error {
+	if cl, ok := s.lk.(contextLocker); ok {
+		return cl.RLockContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.rlock()
+	return nil
+}
+
+// lockWith acquires the set's write lock when write is true, or its read lock otherwise,
+// together with other's read lock, and returns a function releasing both. The sets are
+// always locked in address order, so that operations running concurrently on the same pair
+// of sets in opposite directions cannot deadlock. other must not be s.
+func (s *OrderedSet[T]) lockWith(other *OrderedSet[T], write bool) (unlock func()) {
+	lock, unlockSelf := s.rlock, s.runlock
+	if write {
+		lock, unlockSelf = s.lock, s.unlock
+	}
+	if lowerAddress(s, other) {
+		lock()
+		other.rlock()
+	} else {
+		other.rlock()
+		lock()
+	}
+	return func() {
+		other.runlock()
+		unlockSelf()
+	}
+}
+
+// lockBoth acquires the write locks of a and b in address order, like lockWith, and returns
+// a function releasing both. b must not be a.
+func lockBoth[T comparable](a, b *OrderedSet[T]) (unlock func()) {
+	first, second := a, b
+	if !lowerAddress(a, b) {
+		first, second = b, a
+	}
+	first.lock()
+	second.lock()
+	return func() {
+		second.unlock()
+		first.unlock()
+	}
+}
+
+// lowerAddress reports whether a is stored at a lower address than b.
+func lowerAddress[T comparable](a, b *OrderedSet[T]) bool {
+	return uintptr(unsafe.Pointer(a)) < uintptr(unsafe.Pointer(b))
+}
+
+// noopLocker is an rwLocker that does not lock at all.
+type noopLocker struct{}
+
+func (noopLocker) Lock()    {}
+func (noopLocker) Unlock()  {}
+func (noopLocker) RLock()   {}
+func (noopLocker) RUnlock() {}
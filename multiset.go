@@ -0,0 +1,84 @@
+package orderedset
+
+import "sync"
+
+// OrderedMultiset is a generic multiset that tracks the multiplicity of each element
+// while iterating distinct elements in the order of their first insertion.
+type OrderedMultiset[T comparable] struct {
+	mu     sync.RWMutex
+	index  map[T]struct{}
+	values []T
+	counts map[T]int
+}
+
+// NewMultiset creates a new empty OrderedMultiset.
+func NewMultiset[T comparable]() *OrderedMultiset[T] {
+	return &OrderedMultiset[T]{
+		index:  make(map[T]struct{}),
+		values: make([]T, 0),
+		counts: make(map[T]int),
+	}
+}
+
+// Add increments the count of a value, inserting it at the end if it is not already present.
+func (m *OrderedMultiset[T]) Add(value T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.index[value]; !exists {
+		m.index[value] = struct{}{}
+		m.values = append(m.values, value)
+	}
+	m.counts[value]++
+}
+
+// Remove decrements the count of a value, deleting it once the count reaches zero.
+func (m *OrderedMultiset[T]) Remove(value T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.index[value]; !exists {
+		return
+	}
+	m.counts[value]--
+	if m.counts[value] > 0 {
+		return
+	}
+	delete(m.counts, value)
+	delete(m.index, value)
+	for i, v := range m.values {
+		if v == value {
+			m.values = append(m.values[:i], m.values[i+1:]...)
+			break
+		}
+	}
+}
+
+// Count returns the multiplicity of a value, or 0 if it is not present.
+func (m *OrderedMultiset[T]) Count(value T) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.counts[value]
+}
+
+// Has reports whether the multiset contains the given value.
+func (m *OrderedMultiset[T]) Has(value T) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, exists := m.index[value]
+	return exists
+}
+
+// Len returns the number of distinct elements in the multiset.
+func (m *OrderedMultiset[T]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.values)
+}
+
+// Values returns a copy of the distinct values in the order of their first insertion.
+func (m *OrderedMultiset[T]) Values() []T {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	valuesCopy := make([]T, len(m.values))
+	copy(valuesCopy, m.values)
+	return valuesCopy
+}
@@ -0,0 +1,53 @@
+package orderedset_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/babenkoivan/orderedset"
+)
+
+func TestMultisetAdd(t *testing.T) {
+	m := orderedset.NewMultiset[string]()
+	m.Add("b")
+	m.Add("a")
+	m.Add("b")
+	m.Add("b")
+
+	expected := []string{"b", "a"}
+	if !reflect.DeepEqual(m.Values(), expected) {
+		t.Errorf("Add failed: got %v, want %v", m.Values(), expected)
+	}
+	if c := m.Count("b"); c != 3 {
+		t.Errorf("Count failed: got %d, want 3", c)
+	}
+	if c := m.Count("c"); c != 0 {
+		t.Errorf("Count failed: got %d, want 0", c)
+	}
+	if l := m.Len(); l != 2 {
+		t.Errorf("Len failed: got %d, want 2", l)
+	}
+}
+
+func TestMultisetRemove(t *testing.T) {
+	m := orderedset.NewMultiset[string]()
+	m.Add("a")
+	m.Add("a")
+	m.Add("b")
+
+	m.Remove("a")
+	if !m.Has("a") || m.Count("a") != 1 {
+		t.Errorf("Remove failed: got count %d, want 1", m.Count("a"))
+	}
+
+	m.Remove("a")
+	if m.Has("a") {
+		t.Error("Remove failed: a should be removed once its count reaches zero")
+	}
+
+	m.Remove("c")
+	expected := []string{"b"}
+	if !reflect.DeepEqual(m.Values(), expected) {
+		t.Errorf("Remove failed: got %v, want %v", m.Values(), expected)
+	}
+}
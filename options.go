@@ -0,0 +1,128 @@
+package orderedset
+
+import "slices"
+
+// Option configures an OrderedSet created with New.
+type Option[T comparable] func(s *OrderedSet[T])
+
+// WithCapacity preallocates room for n elements.
+func WithCapacity[T comparable](n int) Option[T] {
+	return func(s *OrderedSet[T]) {
+		s.values = slices.Grow(s.values, n)
+		index := make(map[T]int, max(n, len(s.values)))
+		for i, v := range s.values {
+			index[v] = i
+		}
+		s.index = index
+		s.base = nil
+		s.gaps = nil
+	}
+}
+
+// WithBounded limits the set to at most limit elements. When an insertion makes the set
+// exceed the limit, elements are evicted from the front, so the set keeps the most
+// recently added elements. A limit of zero or less leaves the set unbounded.
+func WithBounded[T comparable](limit int) Option[T] {
+	return func(s *OrderedSet[T]) {
+		s.max = limit
+		s.evict()
+	}
+}
+
+// WithInitial adds the given values to the set, in order, skipping duplicates.
+func WithInitial[T comparable](values ...T) Option[T] {
+	return func(s *OrderedSet[T]) {
+		for _, v := range values {
+			s.add(v)
+		}
+	}
+}
+
+// WithoutLocking disables locking. The resulting set is not safe for concurrent use,
+// but avoids locking overhead when it is only accessed from a single goroutine.
+func WithoutLocking[T comparable]() Option[T] {
+	return func(s *OrderedSet[T]) {
+		s.lk = noopLocker{}
+	}
+}
+
+// WithCopyOnWrite makes Clone, and operations built on it such as Union, share the set's
+// storage with the clone instead of copying it. Appending to either set keeps the sharing,
+// while any other modification first copies the shared storage.
+func WithCopyOnWrite[T comparable]() Option[T] {
+	return func(s *OrderedSet[T]) {
+		s.cow = true
+	}
+}
+
+// WithValidator makes the set reject values for which validate returns an error. Add and the
+// other insertion methods silently skip rejected values, while AddChecked, UnmarshalJSON and
+// DecodeJSON return the error. Elements already in the set that fail validation are removed.
+// When several validators are given, a value must pass all of them.
+func WithValidator[T comparable](validate func(T) error) Option[T] {
+	return func(s *OrderedSet[T]) {
+		if prev := s.validate; prev != nil {
+			next := validate
+			validate = func(v T) error {
+				if err := prev(v); err != nil {
+					return err
+				}
+				return next(v)
+			}
+		}
+		s.validate = validate
+		s.retain(func(v T) bool { return validate(v) == nil })
+	}
+}
+
+// WithRejectZero makes the set reject the zero value of T, as a validator returning
+// ErrZeroValue would: Add and the other insertion methods silently skip it, while AddChecked,
+// UnmarshalJSON and DecodeJSON return ErrZeroValue.
+func WithRejectZero[T comparable]() Option[T] {
+	return WithValidator(func(v T) error {
+		var zero T
+		if v == zero {
+			return ErrZeroValue
+		}
+		return nil
+	})
+}
+
+// WithInterning makes the set store a canonical instance of each element, shared by every
+// interning set holding an equal element. This only saves memory for elements holding
+// pointers to data that equal values repeat, such as strings, when many sets share common
+// elements; for other element types it only adds the cost of interning. Each set keeps a
+// handle to the canonical instance of its elements, so that they stay canonical across garbage
+// collections.
+func WithInterning[T comparable]() Option[T] {
+	return func(s *OrderedSet[T]) {
+		s.intern = true
+		s.fold()
+		for i, v := range s.values {
+			s.values[i] = s.canonical(v)
+		}
+		s.index = make(map[T]int, len(s.values))
+		s.reindex(0)
+	}
+}
+
+// WithDuplicateCounting makes the set count the attempts to add a value that is already
+// present, which DuplicateAttempts reports. Clones count their own attempts from zero.
+func WithDuplicateCounting[T comparable]() Option[T] {
+	return func(s *OrderedSet[T]) {
+		s.countDup = true
+	}
+}
+
+// WithAutoShrink makes the set reallocate its backing storage after a removal leaves its
+// length below ratio times its capacity, keeping memory proportional to the number of
+// elements without calling Compact. The new capacity is twice the length, so at least half
+// of the elements must be removed before the set shrinks again, and as many added before it
+// grows again: the cost of each reallocation is amortized over that many operations. Ratios
+// above 0.25 are reduced to 0.25 to keep this guarantee, and a ratio of zero or less disables
+// shrinking. Sets with a capacity of 16 or less never shrink.
+func WithAutoShrink[T comparable](ratio float64) Option[T] {
+	return func(s *OrderedSet[T]) {
+		s.shrinkRatio = min(ratio, 0.25)
+	}
+}
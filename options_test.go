@@ -0,0 +1,306 @@
+package orderedset_test
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/babenkoivan/orderedset"
+)
+
+func TestWithCapacityAndInitial(t *testing.T) {
+	for n, opts := range map[string][]orderedset.Option[int]{
+		"capacity first": {orderedset.WithCapacity[int](16), orderedset.WithInitial(1, 2, 2, 3)},
+		"initial first":  {orderedset.WithInitial(1, 2, 2, 3), orderedset.WithCapacity[int](16)},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New(opts...)
+
+			expected := []int{1, 2, 3}
+			if !reflect.DeepEqual(s.Values(), expected) {
+				t.Errorf("New failed: got %v, want %v", s.Values(), expected)
+			}
+			if c := s.Cap(); c < 16 {
+				t.Errorf("WithCapacity failed: got capacity %d, want at least 16", c)
+			}
+			if idx := s.IndexOf(3); idx != 2 {
+				t.Errorf("New failed: IndexOf(3) got %d, want 2", idx)
+			}
+		})
+	}
+}
+
+func TestWithBounded(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(1, 2, 3, 4), orderedset.WithBounded[int](3))
+
+	expected := []int{2, 3, 4}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("WithBounded failed: got %v, want %v", s.Values(), expected)
+	}
+
+	s.Add(5)
+	s.Add(4)
+	expected = []int{3, 4, 5}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("WithBounded failed: got %v, want %v", s.Values(), expected)
+	}
+	if s.Has(2) || s.IndexOf(5) != 2 {
+		t.Error("WithBounded failed: index not updated after eviction")
+	}
+}
+
+func TestWithValidator(t *testing.T) {
+	errNegative := errors.New("negative value")
+	nonNegative := func(v int) error {
+		if v < 0 {
+			return errNegative
+		}
+		return nil
+	}
+	s := orderedset.New(orderedset.WithInitial(1, -1, 2), orderedset.WithValidator(nonNegative))
+
+	s.Add(-2)
+	s.Add(3)
+	if err := s.AddChecked(-3); !errors.Is(err, errNegative) {
+		t.Errorf("AddChecked failed: got error %v, want %v", err, errNegative)
+	}
+	if err := s.AddChecked(4); err != nil {
+		t.Errorf("AddChecked failed: unexpected error %v", err)
+	}
+	s.Update(1, -10)
+
+	expected := []int{1, 2, 3, 4}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("WithValidator failed: got %v, want %v", s.Values(), expected)
+	}
+
+	if err := s.UnmarshalJSON([]byte(`[5, -5]`)); !errors.Is(err, errNegative) {
+		t.Errorf("UnmarshalJSON failed: got error %v, want %v", err, errNegative)
+	}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("UnmarshalJSON failed: set modified on error, got %v", s.Values())
+	}
+}
+
+func TestWithInterning(t *testing.T) {
+	word := func() string { return strings.Repeat("ab", 8) }
+	first := orderedset.New(orderedset.WithInitial(word()), orderedset.WithInterning[string]())
+	runtime.GC()
+	second := orderedset.New(orderedset.WithInterning[string](), orderedset.WithInitial(word()))
+	plain := orderedset.New(orderedset.WithInitial(word()))
+
+	a, _ := first.At(0)
+	b, _ := second.At(0)
+	c, _ := plain.At(0)
+	if unsafe.StringData(a) != unsafe.StringData(b) {
+		t.Error("WithInterning failed: expected equal strings to share their backing array")
+	}
+	if unsafe.StringData(a) == unsafe.StringData(c) {
+		t.Error("WithInterning failed: expected a set without interning to keep its own string")
+	}
+	if !first.Has(word()) || second.IndexOf(word()) != 0 {
+		t.Error("WithInterning failed: lookup by an equal string failed")
+	}
+}
+
+func TestWithInterningKeepsOnlyCanonicalStrings(t *testing.T) {
+	s := orderedset.New(orderedset.WithInterning[string]())
+	s.Add(strings.Repeat("x", 1024))
+	s.Add(strings.Repeat("x", 1024))
+
+	stored, _ := s.At(0)
+	keys := orderedset.HandleKeys(s)
+	if len(keys) != 1 {
+		t.Fatalf("WithInterning failed: got %d handles, want 1", len(keys))
+	}
+	if unsafe.StringData(keys[0]) != unsafe.StringData(stored) {
+		t.Error("WithInterning failed: expected the handle to be keyed by the stored string")
+	}
+}
+
+func TestWithDuplicateCounting(t *testing.T) {
+	s := orderedset.New(orderedset.WithDuplicateCounting[int]())
+	for range 4 {
+		s.Add(1)
+	}
+	s.Add(2)
+	s.AddAllFunc([]int{2, 3, 3}, nil)
+
+	if got := s.DuplicateAttempts(); got != 5 {
+		t.Errorf("DuplicateAttempts failed: got %d, want 5", got)
+	}
+	if got := s.Clone().DuplicateAttempts(); got != 0 {
+		t.Errorf("DuplicateAttempts failed: got %d for a clone, want 0", got)
+	}
+
+	err := s.Transaction(func(tx *orderedset.OrderedSet[int]) error {
+		tx.Add(1)
+		tx.Add(4)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if got := s.DuplicateAttempts(); got != 6 {
+		t.Errorf("DuplicateAttempts failed: got %d after a transaction, want 6", got)
+	}
+
+	plain := orderedset.New(orderedset.WithInitial(1))
+	plain.Add(1)
+	if got := plain.DuplicateAttempts(); got != 0 {
+		t.Errorf("DuplicateAttempts failed: got %d without counting, want 0", got)
+	}
+}
+
+func TestWithAutoShrink(t *testing.T) {
+	s := orderedset.New(orderedset.WithAutoShrink[int](0.25))
+	for i := range 1000 {
+		s.Add(i)
+	}
+	grown := s.Cap()
+
+	for i := range 990 {
+		s.Remove(i)
+	}
+	if c := s.Cap(); c >= grown/10 {
+		t.Errorf("WithAutoShrink failed: got capacity %d after removals, want less than %d", c, grown/10)
+	}
+	expected := []int{990, 991, 992, 993, 994, 995, 996, 997, 998, 999}
+	if !reflect.DeepEqual(s.Values(), expected) || s.IndexOf(999) != 9 {
+		t.Errorf("WithAutoShrink failed: got %v, want %v", s.Values(), expected)
+	}
+
+	shrunk := s.Cap()
+	for i := range 100 {
+		s.Add(-i)
+		s.Remove(-i)
+	}
+	if c := s.Cap(); c != shrunk {
+		t.Errorf("WithAutoShrink failed: got capacity %d after alternating Add and Remove, want %d", c, shrunk)
+	}
+}
+
+func TestWithRejectZero(t *testing.T) {
+	ints := orderedset.New(orderedset.WithRejectZero[int](), orderedset.WithInitial(0, 1, 2))
+	ints.Add(0)
+	if err := ints.AddChecked(0); !errors.Is(err, orderedset.ErrZeroValue) {
+		t.Errorf("AddChecked failed: got error %v, want %v", err, orderedset.ErrZeroValue)
+	}
+	if expected := []int{1, 2}; !reflect.DeepEqual(ints.Values(), expected) {
+		t.Errorf("WithRejectZero failed: got %v, want %v", ints.Values(), expected)
+	}
+
+	strs := orderedset.New(orderedset.WithRejectZero[string]())
+	strs.Add("")
+	strs.Add("a")
+	if err := strs.UnmarshalJSON([]byte(`["b", ""]`)); !errors.Is(err, orderedset.ErrZeroValue) {
+		t.Errorf("UnmarshalJSON failed: got error %v, want %v", err, orderedset.ErrZeroValue)
+	}
+	if expected := []string{"a"}; !reflect.DeepEqual(strs.Values(), expected) {
+		t.Errorf("WithRejectZero failed: got %v, want %v", strs.Values(), expected)
+	}
+
+	both := orderedset.New(orderedset.WithRejectZero[int](), orderedset.WithValidator(func(v int) error {
+		if v < 0 {
+			return errors.New("negative value")
+		}
+		return nil
+	}))
+	both.Add(0)
+	both.Add(-1)
+	both.Add(1)
+	if expected := []int{1}; !reflect.DeepEqual(both.Values(), expected) {
+		t.Errorf("WithValidator failed: got %v with two validators, want %v", both.Values(), expected)
+	}
+}
+
+func TestWithoutLocking(t *testing.T) {
+	s := orderedset.New(orderedset.WithoutLocking[int](), orderedset.WithInitial(1, 2))
+	s.Add(3)
+	s.Remove(1)
+
+	expected := []int{2, 3}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("WithoutLocking failed: got %v, want %v", s.Values(), expected)
+	}
+}
+
+func TestWithCopyOnWrite(t *testing.T) {
+	s := orderedset.New(orderedset.WithCopyOnWrite[int](), orderedset.WithInitial(1, 2, 3))
+
+	clone := s.Clone()
+	clone.Add(4)
+	s.Add(5)
+	if !reflect.DeepEqual(s.Values(), []int{1, 2, 3, 5}) || !reflect.DeepEqual(clone.Values(), []int{1, 2, 3, 4}) {
+		t.Errorf("WithCopyOnWrite failed: got %v and %v after appends", s.Values(), clone.Values())
+	}
+	if s.Has(4) || clone.Has(5) || clone.IndexOf(4) != 3 || !clone.Has(2) {
+		t.Error("WithCopyOnWrite failed: membership leaked between clones")
+	}
+
+	second := clone.Clone()
+	clone.Remove(1)
+	clone.SortBy(func(a, b int) bool { return a > b })
+	second.Update(2, 20)
+	if !reflect.DeepEqual(s.Values(), []int{1, 2, 3, 5}) {
+		t.Errorf("WithCopyOnWrite failed: original modified, got %v", s.Values())
+	}
+	if !reflect.DeepEqual(clone.Values(), []int{4, 3, 2}) {
+		t.Errorf("WithCopyOnWrite failed: got %v, want [4 3 2]", clone.Values())
+	}
+	if !reflect.DeepEqual(second.Values(), []int{1, 20, 3, 4}) || second.IndexOf(20) != 1 {
+		t.Errorf("WithCopyOnWrite failed: got %v, want [1 20 3 4]", second.Values())
+	}
+
+	union := s.Union(orderedset.New(orderedset.WithInitial(5, 6)))
+	if !reflect.DeepEqual(union.Values(), []int{1, 2, 3, 5, 6}) {
+		t.Errorf("Union failed: got %v, want [1 2 3 5 6]", union.Values())
+	}
+}
+
+func TestWithCopyOnWriteConcurrent(t *testing.T) {
+	s := orderedset.New(orderedset.WithCopyOnWrite[int](), orderedset.WithInitial(1, 2, 3))
+	clone := s.Clone()
+
+	var wg sync.WaitGroup
+	for _, set := range []*orderedset.OrderedSet[int]{s, clone} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				set.Add(10 + i)
+				set.Has(2)
+				set.Remove(10 + i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(s.Values(), clone.Values()) {
+		t.Errorf("WithCopyOnWrite failed: got %v and %v", s.Values(), clone.Values())
+	}
+}
+
+func BenchmarkUnionLargeReceiver(b *testing.B) {
+	for n, opts := range map[string][]orderedset.Option[int]{
+		"Eager":       nil,
+		"CopyOnWrite": {orderedset.WithCopyOnWrite[int]()},
+	} {
+		large := orderedset.New(opts...)
+		for i := range 100000 {
+			large.Add(i)
+		}
+		small := orderedset.New(orderedset.WithInitial(-1, -2, 5))
+
+		b.Run(n, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				large.Union(small)
+			}
+		})
+	}
+}
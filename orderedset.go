@@ -4,214 +4,2679 @@
 package orderedset
 
 import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"container/heap"
+	"context"
+	"encoding"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"hash/maphash"
+	"io"
+	"iter"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
+	"time"
+	"unique"
+	"unsafe"
+)
+
+// minShrinkCap is the capacity up to which a set created with WithAutoShrink never shrinks.
+const minShrinkCap = 16
+
+var (
+	// ErrIndexOutOfRange is returned when an index falls outside the bounds of the set.
+	ErrIndexOutOfRange = errors.New("index out of range")
+	// ErrInvalidRange is returned when the start of a range is greater than its end.
+	ErrInvalidRange = errors.New("invalid range")
+	// ErrZeroValue is returned when the zero value is added to a set created with WithRejectZero.
+	ErrZeroValue = errors.New("zero value")
+	// ErrNotFound is returned when an operation refers to an element that is not in the set.
+	ErrNotFound = errors.New("element not found")
+	// ErrAlreadyPresent is returned when an element to insert is already in the set.
+	ErrAlreadyPresent = errors.New("element already present")
 )
 
 // OrderedSet is a generic set that preserves insertion order.
+//
+// Has runs in constant time, IndexOf in logarithmic time and appending in amortized constant
+// time. Removing the element at position i takes amortized O(min(i, n-i)) time, so removing
+// from either end is cheap.
 type OrderedSet[T comparable] struct {
-	mu     sync.RWMutex
-	index  map[T]struct{}
-	values []T
+	mu sync.RWMutex
+	lk rwLocker
+	// index records a position for each element, which exceeds its actual position by the
+	// number of gaps before it, so that removals do not have to rewrite the index.
+	index map[T]int
+	// gaps holds the recorded positions of elements removed since the index was last rebuilt,
+	// in increasing order, which IndexOf counts with a binary search.
+	gaps        []int
+	values      []T
+	strict      bool
+	less        func(a, b T) bool
+	enc         func(T) (json.RawMessage, error)
+	dec         func(json.RawMessage) (T, error)
+	max         int
+	cow         bool
+	base        map[T]int
+	validate    func(T) error
+	intern      bool
+	handles     map[T]unique.Handle[T]
+	countDup    bool
+	dupCount    uint64
+	shrinkRatio float64
+	nextSeq     uint64
+	pending     map[uint64]T
+	pinned      map[T]struct{}
+	ttl         time.Duration
+	clock       func() time.Time
+	stamps      map[T]time.Time
+	// oldest is a lower bound on the timestamps in stamps, so that purge can tell without
+	// scanning the elements that none of them has expired.
+	oldest time.Time
+}
+
+// New creates a new empty OrderedSet configured by the given options.
+func New[T comparable](opts ...Option[T]) *OrderedSet[T] {
+	s := &OrderedSet[T]{
+		index:  make(map[T]int),
+		values: make([]T, 0),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewSorted creates a new empty OrderedSet that keeps its elements sorted by less
+// instead of by insertion order. Add places each element at its sorted position
+// using binary search, and SortBy has no effect on such a set.
+func NewSorted[T comparable](less func(a, b T) bool) *OrderedSet[T] {
+	s := New[T]()
+	s.less = less
+	return s
+}
+
+// NewContextAware creates a new empty OrderedSet whose lock can be acquired with a deadline.
+// HasContext and ValuesContext on such a set give up waiting for the lock and return
+// ctx.Err() when ctx is done first. The lock is implemented with channels instead of
+// sync.RWMutex, which makes uncontended operations slightly slower. Sets derived from it,
+// such as clones, use regular locking.
+func NewContextAware[T comparable]() *OrderedSet[T] {
+	s := New[T]()
+	s.lk = &chanRWMutex{}
+	return s
+}
+
+// NewInstrumented creates a new empty OrderedSet that records how its lock is used,
+// which can be read with Stats to tell whether the set is contended. Recording makes every
+// operation slightly slower. Sets derived from it, such as clones, are not instrumented.
+func NewInstrumented[T comparable]() *OrderedSet[T] {
+	s := New[T]()
+	s.lk = &instrumentedRWMutex{}
+	return s
+}
+
+// NewExpiring creates a new empty OrderedSet whose elements expire ttl after they were last
+// added, as measured by clock, or by time.Now if clock is nil. Adding a present value again
+// refreshes its timestamp without moving it, while adding an expired value again moves it to
+// the end. Expired elements are removed whenever the set is locked, so every method sees only
+// live elements. Every method takes the write lock on such a set, and takes O(n) time whenever
+// an element may have expired. Sets derived from it, such as clones, do not expire their elements.
+func NewExpiring[T comparable](ttl time.Duration, clock func() time.Time) *OrderedSet[T] {
+	if clock == nil {
+		clock = time.Now
+	}
+	s := New[T]()
+	s.ttl = ttl
+	s.clock = clock
+	s.stamps = make(map[T]time.Time)
+	return s
+}
+
+// Collect creates a new OrderedSet from the values of seq, in order, skipping duplicates.
+func Collect[T comparable](seq iter.Seq[T]) *OrderedSet[T] {
+	s := New[T]()
+	for v := range seq {
+		s.add(v)
+	}
+	return s
+}
+
+// FromSortedSlice creates a new OrderedSet holding the values of sorted, in order, skipping
+// duplicates. Since the set keeps the order of sorted, it can be searched with BinarySearch.
+func FromSortedSlice[T comparable](sorted []T) *OrderedSet[T] {
+	s := New(WithCapacity[T](len(sorted)))
+	for _, v := range sorted {
+		s.add(v)
+	}
+	return s
+}
+
+// NewFromMatches creates a new OrderedSet of the distinct matches of pattern in text,
+// in order of their first appearance.
+func NewFromMatches(pattern *regexp.Regexp, text string) *OrderedSet[string] {
+	s := New[string]()
+	for _, match := range pattern.FindAllString(text, -1) {
+		s.add(match)
+	}
+	return s
+}
+
+// Add inserts a value into the set if it is not already present.
+func (s *OrderedSet[T]) Add(value T) {
+	s.lock()
+	defer s.unlock()
+	s.addCounted(value)
+}
+
+// AddAllFunc inserts the given values in order and calls onDuplicate for each value that was
+// skipped because it was already present, including values repeated within the batch.
+// The values are added under a single write lock, which is released before onDuplicate is
+// called, so onDuplicate may safely use the set.
+func (s *OrderedSet[T]) AddAllFunc(values []T, onDuplicate func(T)) {
+	var duplicates []T
+	s.lock()
+	for _, v := range values {
+		if s.addCounted(v) {
+			continue
+		}
+		if _, exists := s.pos(v); exists {
+			duplicates = append(duplicates, v)
+		}
+	}
+	s.unlock()
+
+	if onDuplicate == nil {
+		return
+	}
+	for _, v := range duplicates {
+		onDuplicate(v)
+	}
+}
+
+// GetOrAdd returns the stored element equal to value with loaded true if there is one, and
+// otherwise adds value and returns the element as stored, which differs from value only in
+// a set created with WithInterning, with loaded false. A value rejected by the validator is
+// returned without being added.
+func (s *OrderedSet[T]) GetOrAdd(value T) (stored T, loaded bool) {
+	s.lock()
+	defer s.unlock()
+	if i, exists := s.pos(value); exists {
+		return s.values[i], true
+	}
+	if !s.add(value) {
+		return value, false
+	}
+	i, _ := s.pos(value)
+	return s.values[i], false
+}
+
+// AddChecked inserts a value into the set if it is not already present, like Add, but returns
+// the validator's error instead of silently skipping a value rejected by WithValidator.
+func (s *OrderedSet[T]) AddChecked(value T) error {
+	s.lock()
+	defer s.unlock()
+	if s.validate != nil {
+		if err := s.validate(value); err != nil {
+			return err
+		}
+	}
+	s.addCounted(value)
+	return nil
+}
+
+// AddIf inserts a value into the set if cond is satisfied and reports whether the value was added.
+// The write lock is held while cond runs, so the check and the insertion happen atomically.
+// cond receives an unlocked view sharing the set's storage: it may only call inspection methods
+// such as Has, Len, At or Values on the view, and must neither mutate the view nor use the
+// original set, which would deadlock.
+func (s *OrderedSet[T]) AddIf(value T, cond func(s *OrderedSet[T]) bool) bool {
+	s.lock()
+	defer s.unlock()
+	view := &OrderedSet[T]{index: s.index, base: s.base, gaps: s.gaps, values: s.values}
+	if !cond(view) {
+		return false
+	}
+	return s.addCounted(value)
+}
+
+// AddOrdered inserts a value like Add, but in the order given by seq rather than by call order,
+// which makes the resulting order deterministic when several goroutines add concurrently.
+// Sequence numbers start at 0: a value is held back until the values with all lower sequence
+// numbers have been added, and calls reusing an already seen sequence number are ignored.
+func (s *OrderedSet[T]) AddOrdered(seq uint64, value T) {
+	s.lock()
+	defer s.unlock()
+	if seq < s.nextSeq {
+		return
+	}
+	if s.pending == nil {
+		s.pending = make(map[uint64]T)
+	}
+	if _, exists := s.pending[seq]; exists {
+		return
+	}
+	s.pending[seq] = value
+	for {
+		v, ok := s.pending[s.nextSeq]
+		if !ok {
+			return
+		}
+		delete(s.pending, s.nextSeq)
+		s.nextSeq++
+		s.add(v)
+	}
+}
+
+// DuplicateAttempts returns the number of times Add, AddChecked, AddIf or AddAllFunc was asked
+// to insert a value that was already present. It is only counted for a set created with
+// WithDuplicateCounting, and always returns 0 otherwise.
+func (s *OrderedSet[T]) DuplicateAttempts() uint64 {
+	s.rlock()
+	defer s.runlock()
+	return s.dupCount
+}
+
+// addCounted inserts a value like add, and counts the attempt when the value is already
+// present in a set created with WithDuplicateCounting. The caller must hold the write lock.
+func (s *OrderedSet[T]) addCounted(value T) bool {
+	if s.countDup {
+		if _, exists := s.pos(value); exists {
+			s.dupCount++
+			s.stamp(value)
+			return false
+		}
+	}
+	return s.add(value)
+}
+
+// add inserts a value into the set and reports whether it was added, which it is not when it
+// is already present or rejected by the validator. The caller must hold the write lock.
+func (s *OrderedSet[T]) add(value T) bool {
+	if _, exists := s.pos(value); exists {
+		s.stamp(value)
+		return false
+	}
+	value, ok := s.admit(value)
+	if !ok {
+		return false
+	}
+	s.init()
+	s.stamp(value)
+	if s.less == nil {
+		s.index[value] = len(s.values) + len(s.gaps)
+		s.values = append(s.values, value)
+		s.evict()
+		return true
+	}
+	i := sort.Search(len(s.values), func(i int) bool {
+		return s.less(value, s.values[i])
+	})
+	s.values = slices.Insert(s.values, i, value)
+	s.reindex(i)
+	s.evict()
+	return true
+}
+
+// stamp records the current time as the time value was added to a set created with
+// NewExpiring. The caller must hold the write lock.
+func (s *OrderedSet[T]) stamp(value T) {
+	if s.ttl <= 0 {
+		return
+	}
+	if s.stamps == nil {
+		s.stamps = make(map[T]time.Time)
+	}
+	s.stamps[value] = s.clock()
+}
+
+// restamp records the current time as the time every element was added to a set created with
+// NewExpiring, dropping the timestamps of absent elements. The caller must hold the write lock.
+func (s *OrderedSet[T]) restamp() {
+	if s.ttl <= 0 {
+		return
+	}
+	now := s.clock()
+	s.stamps = make(map[T]time.Time, len(s.values))
+	for _, v := range s.values {
+		s.stamps[v] = now
+	}
+	s.oldest = now
+}
+
+// expired reports whether value, which must be present, has expired at now. An element without
+// a timestamp, such as one swapped in from a set not created with NewExpiring, is stamped with
+// now instead. The caller must hold the write lock.
+func (s *OrderedSet[T]) expired(value T, now time.Time) bool {
+	stamp, ok := s.stamps[value]
+	if !ok {
+		if s.stamps == nil {
+			s.stamps = make(map[T]time.Time)
+		}
+		s.stamps[value] = now
+		return false
+	}
+	return now.Sub(stamp) >= s.ttl
+}
+
+// purge removes the expired elements of a set created with NewExpiring, scanning them only
+// once the oldest timestamp may have expired. It does nothing for other sets.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) purge() {
+	if s.ttl <= 0 {
+		return
+	}
+	now := s.clock()
+	if now.Sub(s.oldest) < s.ttl {
+		return
+	}
+	if slices.ContainsFunc(s.values, func(v T) bool { return s.expired(v, now) }) {
+		s.retain(func(v T) bool { return !s.expired(v, now) })
+	}
+	s.oldest = now
+	for _, v := range s.values {
+		if stamp := s.stamps[v]; stamp.Before(s.oldest) {
+			s.oldest = stamp
+		}
+	}
+}
+
+// admit reports whether value may be inserted into the set, and returns the form in which
+// it is stored, interned when the set was created with WithInterning.
+func (s *OrderedSet[T]) admit(value T) (T, bool) {
+	if s.validate != nil && s.validate(value) != nil {
+		return value, false
+	}
+	if s.intern {
+		value = s.canonical(value)
+	}
+	return value, true
+}
+
+// canonical returns the canonical instance of value and keeps its handle while the set holds
+// value, since the runtime only keeps a canonical instance alive while a handle to it exists.
+// The handle is keyed by the canonical instance, so that the set does not keep value alive.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) canonical(value T) T {
+	h, ok := s.handles[value]
+	if !ok {
+		h = unique.Make(value)
+		if s.handles == nil {
+			s.handles = make(map[T]unique.Handle[T])
+		}
+		s.handles[h.Value()] = h
+	}
+	return h.Value()
+}
+
+// evict removes elements from the front of a bounded set until it fits its maximum size.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) evict() {
+	if s.max <= 0 || len(s.values) <= s.max {
+		return
+	}
+	s.drop(0, len(s.values)-s.max)
+}
+
+// InsertSetAt inserts the elements of other that are not already present, starting at index
+// and preserving other's order, shifting the following elements to the right.
+// In a set created with NewSorted the elements are placed at their sorted positions instead.
+// Inserting a set into itself leaves it unchanged. Returns an error if index is out of range.
+func (s *OrderedSet[T]) InsertSetAt(index int, other *OrderedSet[T]) error {
+	if other == s {
+		s.rlock()
+		defer s.runlock()
+		if index < 0 || index > len(s.values) {
+			return fmt.Errorf("index %d: %w", index, ErrIndexOutOfRange)
+		}
+		return nil
+	}
+	defer s.lockWith(other, true)()
+	if index < 0 || index > len(s.values) {
+		return fmt.Errorf("index %d: %w", index, ErrIndexOutOfRange)
+	}
+
+	if s.less != nil {
+		for _, v := range other.values {
+			s.add(v)
+		}
+		return nil
+	}
+
+	s.init()
+	inserted := make([]T, 0, len(other.values))
+	for _, v := range other.values {
+		if _, exists := s.pos(v); exists {
+			continue
+		}
+		if v, ok := s.admit(v); ok {
+			inserted = append(inserted, v)
+		}
+	}
+	s.values = slices.Insert(s.values, index, inserted...)
+	s.reindex(index)
+	for _, v := range inserted {
+		s.stamp(v)
+	}
+	s.evict()
+	return nil
+}
+
+// init allocates the index of a zero-value set. The caller must hold the write lock.
+func (s *OrderedSet[T]) init() {
+	if s.index == nil {
+		s.index = make(map[T]int)
+	}
+}
+
+// reindex records the positions of the elements from index "from" onwards, or of all elements
+// if there are gaps, which it clears. The caller must hold the write lock.
+func (s *OrderedSet[T]) reindex(from int) {
+	s.init()
+	s.fold()
+	if len(s.gaps) > 0 {
+		from = 0
+		s.gaps = s.gaps[:0]
+	}
+	for i := from; i < len(s.values); i++ {
+		s.index[s.values[i]] = i
+	}
+}
+
+// pos returns the position of value, looking it up in the shared base index as well.
+// The caller must hold the read lock.
+func (s *OrderedSet[T]) pos(value T) (int, bool) {
+	i, exists := s.slot(value)
+	if !exists {
+		return 0, false
+	}
+	gaps, _ := slices.BinarySearch(s.gaps, i)
+	return i - gaps, true
+}
+
+// slot returns the position recorded for value in the index, which exceeds its actual
+// position by the number of gaps before it. The caller must hold the read lock.
+func (s *OrderedSet[T]) slot(value T) (int, bool) {
+	if i, exists := s.index[value]; exists {
+		return i, true
+	}
+	i, exists := s.base[value]
+	return i, exists
+}
+
+// vacate records the given recorded positions, in increasing order, as gaps left by removed
+// elements. Gaps at the end of the recorded positions are dropped, since appending never refers
+// to them. The index is rebuilt once the gaps outnumber a quarter of the elements, which spreads
+// the cost of rebuilding over the removals that caused it. The caller must hold the write lock.
+func (s *OrderedSet[T]) vacate(slots []int) {
+	if len(slots) == 0 {
+		return
+	}
+	i, _ := slices.BinarySearch(s.gaps, slots[0])
+	s.gaps = append(s.gaps, slots...)
+	if i < len(s.gaps)-len(slots) {
+		slices.Sort(s.gaps[i:])
+	}
+	for len(s.gaps) > 0 && s.gaps[len(s.gaps)-1] == len(s.values)+len(s.gaps)-1 {
+		s.gaps = s.gaps[:len(s.gaps)-1]
+	}
+	if len(s.gaps) > len(s.values)/4 {
+		s.reindex(0)
+	}
+}
+
+// cut deletes the values from index "from" to "to", shifting the values before or after them,
+// whichever are fewer. The caller must hold the write lock.
+func (s *OrderedSet[T]) cut(from, to int) {
+	if from < len(s.values)-to {
+		n := to - from
+		copy(s.values[n:to], s.values[:from])
+		clear(s.values[:n])
+		s.values = s.values[n:]
+		return
+	}
+	s.values = slices.Delete(s.values, from, to)
+}
+
+// fold merges the shared base index of a copy-on-write clone into a private index and copies
+// the values, so that the set can be modified in place. The caller must hold the write lock.
+func (s *OrderedSet[T]) fold() {
+	if s.base == nil {
+		return
+	}
+	index := make(map[T]int, len(s.base)+len(s.index))
+	maps.Copy(index, s.base)
+	maps.Copy(index, s.index)
+	s.index = index
+	s.base = nil
+	s.values = slices.Clone(s.values)
+}
+
+// ReplaceContents replaces all elements of the set with the given values, skipping duplicates,
+// in a single locked operation, so readers observe either the old or the new contents in full.
+func (s *OrderedSet[T]) ReplaceContents(values []T) {
+	s.lock()
+	defer s.unlock()
+	_ = s.replace(values, false)
+}
+
+// replace replaces all elements of the set with the given values. Duplicates are skipped,
+// or reported as an error leaving the set unchanged when strict is true. Values rejected by
+// the validator are skipped.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) replace(raw []T, strict bool) error {
+	index := make(map[T]int, len(raw))
+	values := make([]T, 0, len(raw))
+	for i, v := range raw {
+		if _, exists := index[v]; exists {
+			if strict {
+				return fmt.Errorf("duplicate element at index %d", i)
+			}
+			continue
+		}
+		v, ok := s.admit(v)
+		if !ok {
+			continue
+		}
+		index[v] = len(values)
+		values = append(values, v)
+	}
+	if s.less != nil {
+		sort.SliceStable(values, func(i, j int) bool {
+			return s.less(values[i], values[j])
+		})
+		for i, v := range values {
+			index[v] = i
+		}
+	}
+	s.index = index
+	s.base = nil
+	s.gaps = nil
+	s.values = values
+	s.prunePins()
+	s.pruneHandles()
+	s.restamp()
+	s.evict()
+	return nil
+}
+
+// Remove deletes a value from the set.
+func (s *OrderedSet[T]) Remove(value T) {
+	s.lock()
+	defer s.unlock()
+	s.remove(value)
+}
+
+// Take deletes a value from the set and reports whether it was present.
+func (s *OrderedSet[T]) Take(value T) bool {
+	s.lock()
+	defer s.unlock()
+	return s.remove(value)
+}
+
+// remove deletes a value from the set and reports whether it was present.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) remove(value T) bool {
+	i, exists := s.pos(value)
+	if !exists {
+		return false
+	}
+	s.removeAt(i)
+	return true
+}
+
+// removeAt deletes the element at index, which shifts the positions of the following elements.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) removeAt(index int) {
+	s.removeRange(index, index+1)
+}
+
+// Update replaces old with replacement at old's position and reports whether it did so.
+// The set is left unchanged if old is not present or replacement is already present.
+// In a set created with NewSorted, replacement is placed at its sorted position instead.
+func (s *OrderedSet[T]) Update(old, replacement T) bool {
+	s.lock()
+	defer s.unlock()
+	return s.update(old, replacement)
+}
+
+// CompareAndReplace replaces old with replacement only if old is still present and
+// replacement is not, and reports whether it did so. It is equivalent to Update, which makes
+// the check and the replacement under a single write lock, so of several goroutines racing
+// to replace the same element, exactly one succeeds.
+func (s *OrderedSet[T]) CompareAndReplace(old, replacement T) bool {
+	return s.Update(old, replacement)
+}
+
+// update replaces old with replacement and reports whether it did so.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) update(old, replacement T) bool {
+	if _, exists := s.pos(replacement); exists {
+		return false
+	}
+	i, exists := s.pos(old)
+	if !exists {
+		return false
+	}
+	replacement, ok := s.admit(replacement)
+	if !ok {
+		return false
+	}
+	if s.less != nil {
+		s.removeAt(i)
+		return s.add(replacement)
+	}
+	s.fold()
+	slot, _ := s.slot(old)
+	s.values[i] = replacement
+	delete(s.index, old)
+	delete(s.pinned, old)
+	delete(s.handles, old)
+	delete(s.stamps, old)
+	s.index[replacement] = slot
+	s.stamp(replacement)
+	return true
+}
+
+// RemoveAt deletes a value by index and returns it. If index is invalid, ok is false.
+func (s *OrderedSet[T]) RemoveAt(index int) (val T, ok bool) {
+	s.lock()
+	defer s.unlock()
+	if index < 0 || index >= len(s.values) {
+		var zero T
+		return zero, false
+	}
+	val = s.values[index]
+	s.removeAt(index)
+	return val, true
+}
+
+// RemoveRange deletes the elements from index "from" (inclusive) to "to" (exclusive) and
+// returns them in order. Returns an error if indices are out of range or invalid.
+func (s *OrderedSet[T]) RemoveRange(from, to int) (removed []T, err error) {
+	s.lock()
+	defer s.unlock()
+
+	if from < 0 {
+		return nil, fmt.Errorf("from index %d is negative: %w", from, ErrIndexOutOfRange)
+	}
+	if to > len(s.values) {
+		return nil, fmt.Errorf("to index %d: %w", to, ErrIndexOutOfRange)
+	}
+	if from > to {
+		return nil, fmt.Errorf("from index %d is greater than to index %d: %w", from, to, ErrInvalidRange)
+	}
+
+	return s.removeRange(from, to), nil
+}
+
+// PopN removes the first n elements, or all elements if the set holds fewer, and returns
+// them in order.
+func (s *OrderedSet[T]) PopN(n int) []T {
+	s.lock()
+	defer s.unlock()
+	return s.removeRange(0, min(max(n, 0), len(s.values)))
+}
+
+// RemoveIter calls fn for each element in order and removes the elements for which it
+// returns true, returning the number removed. The survivors are gathered in a single pass
+// under the write lock, so every element is visited exactly once regardless of removals.
+// Pinned elements are kept and fn is not called for them.
+// fn must not use the set, which would deadlock.
+func (s *OrderedSet[T]) RemoveIter(fn func(value T) bool) int {
+	s.lock()
+	defer s.unlock()
+	return s.retain(func(v T) bool { return s.isPinned(v) || !fn(v) })
+}
+
+// removeRange deletes the elements from index "from" to "to" and returns them in order.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) removeRange(from, to int) []T {
+	removed := s.drop(from, to)
+	s.shrink()
+	return removed
+}
+
+// drop deletes the elements from index "from" to "to" like removeRange, without shrinking the
+// backing storage. The caller must hold the write lock.
+func (s *OrderedSet[T]) drop(from, to int) []T {
+	s.fold()
+	removed := make([]T, to-from)
+	copy(removed, s.values[from:to])
+	slots := make([]int, len(removed))
+	for i, v := range removed {
+		slots[i] = s.index[v]
+		delete(s.index, v)
+		delete(s.pinned, v)
+		delete(s.handles, v)
+		delete(s.stamps, v)
+	}
+	s.cut(from, to)
+	s.vacate(slots)
+	return removed
+}
+
+// Compact reallocates the set's backing storage to fit its current length,
+// releasing memory left over after removals. Contents and order are unchanged.
+func (s *OrderedSet[T]) Compact() {
+	s.lock()
+	defer s.unlock()
+	s.reallocate(len(s.values))
+}
+
+// shrink reallocates the backing storage of a set created with WithAutoShrink to twice its
+// length once the length falls below the configured share of its capacity.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) shrink() {
+	if s.shrinkRatio <= 0 || cap(s.values) <= minShrinkCap {
+		return
+	}
+	if float64(len(s.values)) < s.shrinkRatio*float64(cap(s.values)) {
+		s.reallocate(2 * len(s.values))
+	}
+}
+
+// reallocate copies the elements into new backing storage with the given capacity, and
+// rebuilds the index to fit the current length. The caller must hold the write lock.
+func (s *OrderedSet[T]) reallocate(capacity int) {
+	index := make(map[T]int, len(s.values))
+	for i, v := range s.values {
+		index[v] = i
+	}
+	values := make([]T, len(s.values), capacity)
+	copy(values, s.values)
+	s.index = index
+	s.base = nil
+	s.gaps = nil
+	s.values = values
+}
+
+// Normalize rebuilds the index from the values, dropping any duplicate values while keeping
+// their first occurrences, and returns the number of values dropped. It is a maintenance
+// primitive for recovering a set whose values were modified outside of its methods.
+func (s *OrderedSet[T]) Normalize() int {
+	s.lock()
+	defer s.unlock()
+	return s.normalize()
+}
+
+// normalize rebuilds the index from the values, dropping duplicates, and returns the number
+// of values dropped. The caller must hold the write lock.
+func (s *OrderedSet[T]) normalize() int {
+	s.fold()
+	index := make(map[T]int, len(s.values))
+	values := s.values[:0]
+	for _, v := range s.values {
+		if _, exists := index[v]; exists {
+			continue
+		}
+		index[v] = len(values)
+		values = append(values, v)
+	}
+	removed := len(s.values) - len(values)
+	clear(s.values[len(values):])
+	s.index = index
+	s.gaps = nil
+	s.values = values
+	return removed
+}
+
+// Has reports whether the set contains the given value.
+func (s *OrderedSet[T]) Has(value T) bool {
+	s.rlock()
+	defer s.runlock()
+	_, exists := s.pos(value)
+	return exists
+}
+
+// HasEach reports, for each of the given values, whether the set contains it.
+// result[i] corresponds to values[i]. All lookups are made under a single read lock.
+func (s *OrderedSet[T]) HasEach(values []T) []bool {
+	s.rlock()
+	defer s.runlock()
+	result := make([]bool, len(values))
+	for i, v := range values {
+		_, result[i] = s.pos(v)
+	}
+	return result
+}
+
+// PresentIn returns the given values that the set contains, in the order given. Duplicates
+// in values are kept, so the result has one entry per matching input. All lookups are made
+// under a single read lock.
+func (s *OrderedSet[T]) PresentIn(values []T) []T {
+	s.rlock()
+	defer s.runlock()
+	var present []T
+	for _, v := range values {
+		if _, exists := s.pos(v); exists {
+			present = append(present, v)
+		}
+	}
+	return present
+}
+
+// HasFunc reports whether any element of the set satisfies pred, which allows matching
+// by something other than equality. Unlike Has, which is a map lookup, HasFunc scans the
+// elements under the read lock and takes O(n) time.
+// pred must not use the set, which would deadlock.
+func (s *OrderedSet[T]) HasFunc(pred func(T) bool) bool {
+	s.rlock()
+	defer s.runlock()
+	return slices.ContainsFunc(s.values, pred)
+}
+
+// HasContext reports whether the set contains the given value, or returns ctx.Err() if ctx
+// is done before the read lock is acquired. Like Has, it drops the element if it has expired
+// in a set created with NewExpiring.
+func (s *OrderedSet[T]) HasContext(ctx context.Context, value T) (bool, error) {
+	if err := s.rlockContext(ctx); err != nil {
+		return false, err
+	}
+	defer s.runlock()
+	_, exists := s.pos(value)
+	return exists, nil
+}
+
+// Len returns the number of elements in the set.
+func (s *OrderedSet[T]) Len() int {
+	s.rlock()
+	defer s.runlock()
+	return len(s.values)
+}
+
+// IsEmpty reports whether the set has no elements.
+func (s *OrderedSet[T]) IsEmpty() bool {
+	s.rlock()
+	defer s.runlock()
+	return len(s.values) == 0
+}
+
+// NonEmpty reports whether the set has at least one element.
+func (s *OrderedSet[T]) NonEmpty() bool {
+	s.rlock()
+	defer s.runlock()
+	return len(s.values) > 0
+}
+
+// ValuesContext returns a copy of the values in insertion order, or returns ctx.Err() if ctx
+// is done before the read lock is acquired.
+func (s *OrderedSet[T]) ValuesContext(ctx context.Context) ([]T, error) {
+	if err := s.rlockContext(ctx); err != nil {
+		return nil, err
+	}
+	defer s.runlock()
+	valuesCopy := make([]T, len(s.values))
+	copy(valuesCopy, s.values)
+	return valuesCopy, nil
+}
+
+// Cap returns the capacity of the set's backing slice.
+func (s *OrderedSet[T]) Cap() int {
+	s.rlock()
+	defer s.runlock()
+	return cap(s.values)
+}
+
+// SizeBytes returns a rough estimate of the memory used by the set, in bytes: the set itself,
+// the capacity of its backing slice and the entries of its index. Memory referenced by the
+// elements, such as the bytes of strings, is not included; use SizeBytesFunc for that.
+func (s *OrderedSet[T]) SizeBytes() int {
+	return s.SizeBytesFunc(nil)
+}
+
+// SizeBytesFunc returns the estimate of SizeBytes plus, for each element, the number of bytes
+// that sizer reports the element references outside its fixed size, such as len(v) for
+// strings. A nil sizer adds nothing.
+// sizer must not use the set, which would deadlock.
+func (s *OrderedSet[T]) SizeBytesFunc(sizer func(T) int) int {
+	s.rlock()
+	defer s.runlock()
+	var zero T
+	elem := int(unsafe.Sizeof(zero))
+	// Map entries hold a key, an int position and a control byte, in tables filled up to 7/8.
+	entry := (elem + int(unsafe.Sizeof(0)) + 1) * 8 / 7
+	size := int(unsafe.Sizeof(*s)) + cap(s.values)*elem + (len(s.index)+len(s.base))*entry +
+		cap(s.gaps)*int(unsafe.Sizeof(0))
+	if sizer != nil {
+		for _, v := range s.values {
+			size += sizer(v)
+		}
+	}
+	return size
+}
+
+// hashSeed is the seed with which Hash hashes elements.
+var hashSeed = maphash.MakeSeed()
+
+// Hash returns a fingerprint of the set's elements and their order, which changes with high
+// probability whenever an element is added, removed or moved. Elements are hashed with
+// maphash.Comparable, so the fingerprint is only stable within a single process; use
+// HashFunc for fingerprints that are stored or compared across processes.
+func (s *OrderedSet[T]) Hash() uint64 {
+	return s.HashFunc(func(v T) uint64 {
+		return maphash.Comparable(hashSeed, v)
+	})
+}
+
+// HashFunc returns a fingerprint of the set's elements and their order like Hash, hashing
+// each element with hasher. The element hashes are combined with FNV-1a in order, under the
+// read lock, so the fingerprint is as stable as hasher.
+// hasher must not use the set, which would deadlock.
+func (s *OrderedSet[T]) HashFunc(hasher func(T) uint64) uint64 {
+	s.rlock()
+	defer s.runlock()
+	h := fnv.New64a()
+	var b [8]byte
+	for _, v := range s.values {
+		binary.LittleEndian.PutUint64(b[:], hasher(v))
+		h.Write(b[:])
+	}
+	return h.Sum64()
+}
+
+// Values returns a copy of the values in insertion order. The copy belongs to the caller,
+// so it can be passed directly to functions of the slices package, including ones that
+// modify it such as slices.Sort.
+func (s *OrderedSet[T]) Values() []T {
+	s.rlock()
+	defer s.runlock()
+	valuesCopy := make([]T, len(s.values))
+	copy(valuesCopy, s.values)
+	return valuesCopy
+}
+
+// AppendTo appends the values in insertion order to dst and returns the extended slice.
+func (s *OrderedSet[T]) AppendTo(dst []T) []T {
+	s.rlock()
+	defer s.runlock()
+	return append(dst, s.values...)
+}
+
+// Indices returns the indices of the set's elements, from 0 to Len-1.
+func (s *OrderedSet[T]) Indices() []int {
+	s.rlock()
+	defer s.runlock()
+	indices := make([]int, len(s.values))
+	for i := range indices {
+		indices[i] = i
+	}
+	return indices
+}
+
+// Entry is an element of a set together with its index.
+type Entry[T any] struct {
+	Index int
+	Value T
+}
+
+// Entries returns the elements of the set with their indices, in insertion order.
+// It is meant for consumers that cannot use two-value iteration, such as templates.
+func (s *OrderedSet[T]) Entries() []Entry[T] {
+	s.rlock()
+	defer s.runlock()
+	entries := make([]Entry[T], len(s.values))
+	for i, v := range s.values {
+		entries[i] = Entry[T]{Index: i, Value: v}
+	}
+	return entries
+}
+
+// Enumerate returns an iterator over index-value pairs in insertion order.
+// The iterator ranges over a snapshot taken when iteration starts.
+func (s *OrderedSet[T]) Enumerate() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		for i, v := range s.Values() {
+			if !yield(i, v) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns an iterator over index-value pairs from the last element to the first,
+// with each element's index in insertion order. Like Enumerate, it ranges over a snapshot
+// taken when iteration starts.
+func (s *OrderedSet[T]) Backward() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		values := s.Values()
+		for i := len(values) - 1; i >= 0; i-- {
+			if !yield(i, values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// ForEachLive calls fn for each element in order until fn returns false. Unlike Enumerate,
+// it does not take a snapshot: the read lock is acquired separately for each element, so a
+// slow fn does not block writers. In exchange, the set may change between visits, causing
+// elements to be skipped or visited twice when elements before the current index are
+// added or removed.
+func (s *OrderedSet[T]) ForEachLive(fn func(index int, value T) bool) {
+	for i := 0; ; i++ {
+		v, ok := s.At(i)
+		if !ok || !fn(i, v) {
+			return
+		}
+	}
+}
+
+// ValuesFunc calls fn with the set's internal values slice while holding the read lock,
+// avoiding the copy made by Values. fn must not retain, modify or append to the slice.
+// fn must not use the set, which would deadlock.
+func (s *OrderedSet[T]) ValuesFunc(fn func(values []T)) {
+	s.rlock()
+	defer s.runlock()
+	fn(s.values)
+}
+
+// LenAndValues returns the number of elements and a copy of the values in insertion order,
+// both read under a single lock so that they are consistent with each other.
+func (s *OrderedSet[T]) LenAndValues() (int, []T) {
+	s.rlock()
+	defer s.runlock()
+	valuesCopy := make([]T, len(s.values))
+	copy(valuesCopy, s.values)
+	return len(s.values), valuesCopy
+}
+
+// Stream sends a snapshot of the values in insertion order on the returned channel.
+// The channel is closed once all values are sent or ctx is cancelled. The lock is only
+// held while taking the snapshot, so a slow consumer does not block writers.
+func (s *OrderedSet[T]) Stream(ctx context.Context) <-chan T {
+	values := s.Values()
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for _, v := range values {
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// At returns the element at the given index.
+func (s *OrderedSet[T]) At(index int) (T, bool) {
+	s.rlock()
+	defer s.runlock()
+	if index < 0 || index >= len(s.values) {
+		var zero T
+		return zero, false
+	}
+	return s.values[index], true
+}
+
+// First returns the first element of the set.
+func (s *OrderedSet[T]) First() (T, bool) {
+	return s.At(0)
+}
+
+// Last returns the last element of the set.
+func (s *OrderedSet[T]) Last() (T, bool) {
+	return s.PeekBack(0)
+}
+
+// Oldest returns the least recently inserted element. It is equivalent to First.
+func (s *OrderedSet[T]) Oldest() (T, bool) {
+	return s.First()
+}
+
+// Newest returns the most recently inserted element. It is equivalent to Last.
+func (s *OrderedSet[T]) Newest() (T, bool) {
+	return s.Last()
+}
+
+// PeekBack returns the element n positions from the end without removing it, where 0 is the
+// last element.
+func (s *OrderedSet[T]) PeekBack(n int) (T, bool) {
+	s.rlock()
+	defer s.runlock()
+	if n < 0 || n >= len(s.values) {
+		var zero T
+		return zero, false
+	}
+	return s.values[len(s.values)-1-n], true
+}
+
+// IndexOf returns the index of the given value, or -1 if not found.
+func (s *OrderedSet[T]) IndexOf(value T) int {
+	s.rlock()
+	defer s.runlock()
+	if i, exists := s.pos(value); exists {
+		return i
+	}
+	return -1
+}
+
+// LastIndexOf returns the index of the last occurrence of the given value, or -1 if not found.
+// Since the set holds unique values, the result always matches IndexOf.
+func (s *OrderedSet[T]) LastIndexOf(value T) int {
+	return s.IndexOf(value)
+}
+
+// IndexOfFunc returns the index of the first element satisfying pred, or -1 if none does.
+// pred must not use the set, which would deadlock.
+func (s *OrderedSet[T]) IndexOfFunc(pred func(T) bool) int {
+	s.rlock()
+	defer s.runlock()
+	for i, v := range s.values {
+		if pred(v) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Shift moves value delta positions towards the end of the set, or towards the front when
+// delta is negative, stopping at the first or last position, and reports whether value is
+// present. It does not move elements of a set created with NewSorted.
+func (s *OrderedSet[T]) Shift(value T, delta int) bool {
+	s.lock()
+	defer s.unlock()
+	i, exists := s.pos(value)
+	if !exists {
+		return false
+	}
+	if s.less != nil {
+		return true
+	}
+	s.move(i, min(max(i+delta, 0), len(s.values)-1))
+	return true
+}
+
+// move moves the element at index from to index to, shifting the elements in between.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) move(from, to int) {
+	s.fold()
+	value := s.values[from]
+	if to > from {
+		copy(s.values[from:to], s.values[from+1:to+1])
+	} else {
+		copy(s.values[to+1:from+1], s.values[to:from])
+	}
+	s.values[to] = value
+	if len(s.gaps) > 0 {
+		s.reindex(0)
+		return
+	}
+	for j := min(from, to); j <= max(from, to); j++ {
+		s.index[s.values[j]] = j
+	}
+}
+
+// SortBy sorts the elements of the set in-place using the provided less function.
+// Pinned elements stay at the front, in their current relative order, ahead of the sorted
+// rest. It has no effect on a set created with NewSorted.
+func (s *OrderedSet[T]) SortBy(less func(a, b T) bool) {
+	s.lock()
+	defer s.unlock()
+	if s.less != nil {
+		return
+	}
+	s.fold()
+	pinned := 0
+	if len(s.pinned) > 0 {
+		sort.SliceStable(s.values, func(i, j int) bool {
+			return s.isPinned(s.values[i]) && !s.isPinned(s.values[j])
+		})
+		for pinned < len(s.values) && s.isPinned(s.values[pinned]) {
+			pinned++
+		}
+	}
+	unpinned := s.values[pinned:]
+	sort.Slice(unpinned, func(i, j int) bool {
+		return less(unpinned[i], unpinned[j])
+	})
+	s.reindex(0)
+}
+
+// Pin marks value as pinned, if it is present. SortBy keeps pinned elements at the front of the
+// set, in their current relative order, and RemoveIter and Subtract never remove them.
+// Removals by value or position, such as Remove, RemoveRange and PopN, eviction from a set
+// created with WithBounded and ReplaceContents still remove pinned elements, and unpin them.
+func (s *OrderedSet[T]) Pin(value T) {
+	s.lock()
+	defer s.unlock()
+	if _, exists := s.pos(value); !exists {
+		return
+	}
+	if s.pinned == nil {
+		s.pinned = make(map[T]struct{})
+	}
+	s.pinned[value] = struct{}{}
+}
+
+// Unpin removes the pin from value.
+func (s *OrderedSet[T]) Unpin(value T) {
+	s.lock()
+	defer s.unlock()
+	delete(s.pinned, value)
+}
+
+// isPinned reports whether value is pinned.
+// The caller must hold the read lock.
+func (s *OrderedSet[T]) isPinned(value T) bool {
+	_, pinned := s.pinned[value]
+	return pinned
+}
+
+// prunePins drops the pins of elements that are no longer present.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) prunePins() {
+	maps.DeleteFunc(s.pinned, func(v T, _ struct{}) bool {
+		_, exists := s.pos(v)
+		return !exists
+	})
+}
+
+// pruneHandles drops the interning handles of elements that are no longer present.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) pruneHandles() {
+	maps.DeleteFunc(s.handles, func(v T, _ unique.Handle[T]) bool {
+		_, exists := s.pos(v)
+		return !exists
+	})
+}
+
+// TopN returns the n largest elements according to less, largest first. It selects them with
+// a bounded heap in O(len·log n) time, without sorting the whole set.
+// less must not use the set, which would deadlock.
+func (s *OrderedSet[T]) TopN(n int, less func(a, b T) bool) []T {
+	if n <= 0 {
+		return []T{}
+	}
+	s.rlock()
+	h := &boundedHeap[T]{values: make([]T, 0, min(n, len(s.values))), less: less}
+	for _, v := range s.values {
+		if len(h.values) < n {
+			heap.Push(h, v)
+		} else if less(h.values[0], v) {
+			h.values[0] = v
+			heap.Fix(h, 0)
+		}
+	}
+	s.runlock()
+
+	result := make([]T, len(h.values))
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i] = heap.Pop(h).(T)
+	}
+	return result
+}
+
+// boundedHeap is a min-heap according to less, implementing heap.Interface.
+type boundedHeap[T any] struct {
+	values []T
+	less   func(a, b T) bool
+}
+
+func (h *boundedHeap[T]) Len() int           { return len(h.values) }
+func (h *boundedHeap[T]) Less(i, j int) bool { return h.less(h.values[i], h.values[j]) }
+func (h *boundedHeap[T]) Swap(i, j int)      { h.values[i], h.values[j] = h.values[j], h.values[i] }
+func (h *boundedHeap[T]) Push(x any)         { h.values = append(h.values, x.(T)) }
+
+func (h *boundedHeap[T]) Pop() any {
+	last := h.values[len(h.values)-1]
+	h.values = h.values[:len(h.values)-1]
+	return last
+}
+
+// MinBy returns the smallest element according to less, or ok false if the set is empty.
+// When several elements are equally small, the first of them is returned.
+// less must not use the set, which would deadlock.
+func (s *OrderedSet[T]) MinBy(less func(a, b T) bool) (value T, ok bool) {
+	s.rlock()
+	defer s.runlock()
+	if len(s.values) == 0 {
+		return value, false
+	}
+	value = s.values[0]
+	for _, v := range s.values[1:] {
+		if less(v, value) {
+			value = v
+		}
+	}
+	return value, true
+}
+
+// MaxBy returns the largest element according to less, or ok false if the set is empty.
+// When several elements are equally large, the first of them is returned.
+// less must not use the set, which would deadlock.
+func (s *OrderedSet[T]) MaxBy(less func(a, b T) bool) (value T, ok bool) {
+	s.rlock()
+	defer s.runlock()
+	if len(s.values) == 0 {
+		return value, false
+	}
+	value = s.values[0]
+	for _, v := range s.values[1:] {
+		if less(value, v) {
+			value = v
+		}
+	}
+	return value, true
+}
+
+// IsSortedBy reports whether the elements are in non-decreasing order according to less.
+func (s *OrderedSet[T]) IsSortedBy(less func(a, b T) bool) bool {
+	s.rlock()
+	defer s.runlock()
+	for i := 1; i < len(s.values); i++ {
+		if less(s.values[i], s.values[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSorted reports whether the elements of s are in non-decreasing order.
+func IsSorted[T cmp.Ordered](s *OrderedSet[T]) bool {
+	return s.IsSortedBy(cmp.Less[T])
+}
+
+// BinarySearch searches for target in s and returns the position where target is found, or
+// the position where it would appear, and whether it was found, like slices.BinarySearch.
+// It takes O(log n) time and is only valid when the elements of s are sorted in increasing
+// order, for example as kept by NewSorted with cmp.Less or after SortBy; on an unsorted set
+// the result is meaningless.
+func BinarySearch[T cmp.Ordered](s *OrderedSet[T], target T) (int, bool) {
+	s.rlock()
+	defer s.runlock()
+	return slices.BinarySearch(s.values, target)
+}
+
+// OrderBy returns a new set with the elements sorted using the provided less function,
+// leaving the receiver's order untouched. Equal elements keep their relative order.
+func (s *OrderedSet[T]) OrderBy(less func(a, b T) bool) *OrderedSet[T] {
+	values := s.Values()
+	sort.SliceStable(values, func(i, j int) bool {
+		return less(values[i], values[j])
+	})
+	result := New[T]()
+	for _, v := range values {
+		result.add(v)
+	}
+	return result
+}
+
+// Clone returns a new copy of the set, with its elements in exactly the same order.
+// For a set created with WithCopyOnWrite, the clone shares the set's storage until either
+// of them is modified in a way other than appending, and taking the clone briefly requires
+// the write lock.
+func (s *OrderedSet[T]) Clone() *OrderedSet[T] {
+	if s.cow {
+		s.lock()
+		defer s.unlock()
+		return s.share()
+	}
+	s.rlock()
+	defer s.runlock()
+	return s.clone()
+}
+
+// clone returns a new copy of the set. The values are copied from s.values, never by ranging
+// over the index, whose iteration order is random. The caller must hold the read lock.
+func (s *OrderedSet[T]) clone() *OrderedSet[T] {
+	clone := s.configured()
+	for i, v := range s.values {
+		clone.index[v] = i
+		clone.values = append(clone.values, v)
+	}
+	clone.pinned = maps.Clone(s.pinned)
+	clone.handles = maps.Clone(s.handles)
+	return clone
+}
+
+// configured returns a new empty set with the same options as the set.
+func (s *OrderedSet[T]) configured() *OrderedSet[T] {
+	empty := New[T]()
+	empty.strict = s.strict
+	empty.less = s.less
+	empty.enc = s.enc
+	empty.dec = s.dec
+	empty.max = s.max
+	empty.cow = s.cow
+	empty.validate = s.validate
+	empty.intern = s.intern
+	empty.countDup = s.countDup
+	empty.shrinkRatio = s.shrinkRatio
+	return empty
+}
+
+// DeepClone returns a new set holding cloneElem applied to each element, in order. Unlike
+// Clone, which is shallow and shares the data that pointer or reference elements point to,
+// DeepClone gives a fully independent copy when cloneElem copies that data. Elements that
+// cloneElem maps to equal values are kept once, at their first position.
+func (s *OrderedSet[T]) DeepClone(cloneElem func(T) T) *OrderedSet[T] {
+	s.rlock()
+	defer s.runlock()
+	clone := s.configured()
+	for _, v := range s.values {
+		clone.add(cloneElem(v))
+	}
+	return clone
+}
+
+// share returns a copy-on-write clone of the set. The set's index becomes an immutable base
+// shared by both sets, each keeping its own index for appended elements, and the values are
+// capped so that appending to either set reallocates them. The caller must hold the write lock.
+func (s *OrderedSet[T]) share() *OrderedSet[T] {
+	s.init()
+	switch {
+	case s.base == nil:
+		s.base = s.index
+		s.index = make(map[T]int)
+	case len(s.index) > 0:
+		base := make(map[T]int, len(s.base)+len(s.index))
+		maps.Copy(base, s.base)
+		maps.Copy(base, s.index)
+		s.base = base
+		s.index = make(map[T]int)
+	}
+	s.values = s.values[:len(s.values):len(s.values)]
+
+	clone := s.configured()
+	clone.base = s.base
+	clone.gaps = slices.Clone(s.gaps)
+	clone.values = s.values
+	clone.pinned = maps.Clone(s.pinned)
+	clone.handles = maps.Clone(s.handles)
+	return clone
+}
+
+// Transaction runs fn against a copy of the set and commits the changes made to the copy
+// when fn returns nil. If fn returns an error, the changes are discarded, the set is left
+// unchanged and the error is returned. The write lock is held for the whole transaction,
+// so fn must only use tx and never the original set. The copy of a set created with
+// NewExpiring expires its elements like the set.
+func (s *OrderedSet[T]) Transaction(fn func(tx *OrderedSet[T]) error) error {
+	s.lock()
+	defer s.unlock()
+	tx := s.clone()
+	tx.ttl, tx.clock, tx.stamps, tx.oldest = s.ttl, s.clock, maps.Clone(s.stamps), s.oldest
+	if err := fn(tx); err != nil {
+		return err
+	}
+	tx.lock()
+	defer tx.unlock()
+	s.index = tx.index
+	s.base = tx.base
+	s.gaps = tx.gaps
+	s.values = tx.values
+	s.pinned = tx.pinned
+	s.handles = tx.handles
+	s.stamps = tx.stamps
+	s.oldest = tx.oldest
+	s.dupCount += tx.dupCount
+	return nil
+}
+
+// Swap exchanges the contents of a and b while holding both write locks, so that readers of
+// either set see its contents from before or after the swap, never a mix. Only the elements,
+// with their pins and expiry timestamps, move: options such as NewSorted or WithBounded stay
+// with each set, so the sets are expected to be configured alike.
+func Swap[T comparable](a, b *OrderedSet[T]) {
+	if a == b {
+		return
+	}
+	defer lockBoth(a, b)()
+	a.index, b.index = b.index, a.index
+	a.base, b.base = b.base, a.base
+	a.gaps, b.gaps = b.gaps, a.gaps
+	a.values, b.values = b.values, a.values
+	a.pinned, b.pinned = b.pinned, a.pinned
+	a.handles, b.handles = b.handles, a.handles
+	a.stamps, b.stamps = b.stamps, a.stamps
+	a.oldest, b.oldest = b.oldest, a.oldest
+}
+
+// Union returns a new set containing all elements from both sets.
+// The union of a set with itself is a clone of the set.
+func (s *OrderedSet[T]) Union(other *OrderedSet[T]) *OrderedSet[T] {
+	result := s.Clone()
+	if other == s {
+		return result
+	}
+	for _, v := range other.Values() {
+		result.Add(v)
+	}
+	return result
+}
+
+// Intersect returns a new set with elements common to both sets, in the receiver's order.
+// Membership checks are made against whichever set is smaller, and the receiver's order is
+// restored from the tracked positions, so the cost is proportional to the smaller set's length.
+// The intersection of a set with itself is a clone of the set.
+func (s *OrderedSet[T]) Intersect(other *OrderedSet[T]) *OrderedSet[T] {
+	if other == s {
+		return s.Clone()
+	}
+	result := New[T]()
+	defer s.lockWith(other, false)()
+	if len(other.values) >= len(s.values) {
+		for _, v := range s.values {
+			if _, exists := other.pos(v); exists {
+				result.add(v)
+			}
+		}
+		return result
+	}
+	positions := make([]int, 0, len(other.values))
+	for _, v := range other.values {
+		if i, exists := s.pos(v); exists {
+			positions = append(positions, i)
+		}
+	}
+	slices.Sort(positions)
+	for _, i := range positions {
+		result.add(s.values[i])
+	}
+	return result
+}
+
+// IntersectBySmaller returns a new set with elements common to both sets, in the order of
+// whichever set is smaller (the receiver when both have the same length). It performs
+// exactly one lookup per element of the smaller set.
+// The intersection of a set with itself is a clone of the set.
+func (s *OrderedSet[T]) IntersectBySmaller(other *OrderedSet[T]) *OrderedSet[T] {
+	if other == s {
+		return s.Clone()
+	}
+	result := New[T]()
+	defer s.lockWith(other, false)()
+	smaller, larger := s, other
+	if len(other.values) < len(s.values) {
+		smaller, larger = other, s
+	}
+	for _, v := range smaller.values {
+		if _, exists := larger.pos(v); exists {
+			result.add(v)
+		}
+	}
+	return result
+}
+
+// Difference returns a new set with elements in s that are not in other.
+// The difference of a set with itself is empty.
+func (s *OrderedSet[T]) Difference(other *OrderedSet[T]) *OrderedSet[T] {
+	result := New[T]()
+	if other == s {
+		return result
+	}
+	defer s.lockWith(other, false)()
+	for _, v := range s.values {
+		if _, exists := other.pos(v); !exists {
+			result.add(v)
+		}
+	}
+	return result
+}
+
+// Subtract removes from the set every element present in other, preserving the order
+// of the remaining elements. Unlike Difference, it modifies the receiver in place.
+// Pinned elements are kept.
+func (s *OrderedSet[T]) Subtract(other *OrderedSet[T]) {
+	if other == s {
+		s.lock()
+		defer s.unlock()
+		s.retain(s.isPinned)
+		return
+	}
+	defer s.lockWith(other, true)()
+	s.retain(func(v T) bool {
+		_, exists := other.pos(v)
+		return s.isPinned(v) || !exists
+	})
+}
+
+// UnionSeq returns an iterator over the elements of Union, in the same order, without building
+// a result set. The elements are taken from both sets when iteration starts.
+func (s *OrderedSet[T]) UnionSeq(other *OrderedSet[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		var values []T
+		if other == s {
+			values = s.Values()
+		} else {
+			unlock := s.lockWith(other, false)
+			values = make([]T, len(s.values), len(s.values)+len(other.values))
+			copy(values, s.values)
+			for _, v := range other.values {
+				if _, exists := s.pos(v); !exists {
+					values = append(values, v)
+				}
+			}
+			unlock()
+		}
+		yieldEach(values, yield)
+	}
+}
+
+// IntersectSeq returns an iterator over the elements of Intersect, in the same order, without
+// building a result set. The elements are taken from both sets when iteration starts.
+func (s *OrderedSet[T]) IntersectSeq(other *OrderedSet[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		yieldEach(s.filterWith(other, true), yield)
+	}
+}
+
+// DifferenceSeq returns an iterator over the elements of Difference, in the same order, without
+// building a result set. The elements are taken from both sets when iteration starts.
+func (s *OrderedSet[T]) DifferenceSeq(other *OrderedSet[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		yieldEach(s.filterWith(other, false), yield)
+	}
+}
+
+// filterWith returns the elements of the receiver that other holds when inOther is true,
+// or those it does not hold otherwise, in the receiver's order.
+func (s *OrderedSet[T]) filterWith(other *OrderedSet[T], inOther bool) []T {
+	if other == s {
+		if inOther {
+			return s.Values()
+		}
+		return nil
+	}
+	defer s.lockWith(other, false)()
+	var values []T
+	for _, v := range s.values {
+		if _, exists := other.pos(v); exists == inOther {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// yieldEach passes the values to yield in order until yield returns false.
+func yieldEach[T any](values []T, yield func(T) bool) {
+	for _, v := range values {
+		if !yield(v) {
+			return
+		}
+	}
+}
+
+// OrderedDiff compares the set with other, taken as the new state of the set. added holds
+// the elements only in other, in other's order, removed holds the elements only in the
+// receiver, and moved holds the elements present in both sets at different indices, the
+// latter two in the receiver's order.
+func (s *OrderedSet[T]) OrderedDiff(other *OrderedSet[T]) (added, removed, moved []T) {
+	if other == s {
+		return nil, nil, nil
+	}
+	defer s.lockWith(other, false)()
+	for i, v := range s.values {
+		j, exists := other.pos(v)
+		switch {
+		case !exists:
+			removed = append(removed, v)
+		case i != j:
+			moved = append(moved, v)
+		}
+	}
+	for _, v := range other.values {
+		if _, exists := s.pos(v); !exists {
+			added = append(added, v)
+		}
+	}
+	return added, removed, moved
+}
+
+// EditKind tells what an EditOp does.
+type EditKind int
+
+const (
+	// EditInsert inserts a value that is not present at an index.
+	EditInsert EditKind = iota
+	// EditDelete deletes a value.
+	EditDelete
+	// EditMove moves a present value to an index.
+	EditMove
+)
+
+// String returns the name of the edit kind.
+func (k EditKind) String() string {
+	switch k {
+	case EditInsert:
+		return "Insert"
+	case EditDelete:
+		return "Delete"
+	case EditMove:
+		return "Move"
+	}
+	return fmt.Sprintf("EditKind(%d)", int(k))
+}
+
+// EditOp is a single operation of an edit script. Index is the position of Value once the
+// operation is done, and is unused by EditDelete.
+type EditOp[T any] struct {
+	Kind  EditKind
+	Value T
+	Index int
+}
+
+// EditScript returns operations that, applied in order, turn the set into target. It deletes
+// the elements missing from target first, then inserts the new elements and moves the others,
+// keeping in place a longest run of elements already in target's relative order, so that few
+// elements are moved. Computing the script takes O(n²) time in the worst case.
+func (s *OrderedSet[T]) EditScript(target *OrderedSet[T]) []EditOp[T] {
+	if target == s {
+		return nil
+	}
+	defer s.lockWith(target, false)()
+
+	var ops []EditOp[T]
+	current := make([]T, 0, len(s.values))
+	var positions []int
+	for _, v := range s.values {
+		if j, exists := target.pos(v); exists {
+			current = append(current, v)
+			positions = append(positions, j)
+		} else {
+			ops = append(ops, EditOp[T]{Kind: EditDelete, Value: v})
+		}
+	}
+	kept := make(map[T]bool, len(current))
+	for _, i := range longestIncreasing(positions) {
+		kept[current[i]] = true
+	}
+
+	for j := len(target.values) - 1; j >= 0; j-- {
+		v := target.values[j]
+		if kept[v] {
+			continue
+		}
+		kind := EditInsert
+		from := slices.Index(current, v)
+		if from >= 0 {
+			kind = EditMove
+			current = slices.Delete(current, from, from+1)
+		}
+		to := len(current)
+		if j+1 < len(target.values) {
+			to = slices.Index(current, target.values[j+1])
+		}
+		current = slices.Insert(current, to, v)
+		if from != to {
+			ops = append(ops, EditOp[T]{Kind: kind, Value: v, Index: to})
+		}
+	}
+	return ops
+}
+
+// Apply applies ops, such as those returned by EditScript, in order under the write lock.
+// If an operation is invalid, such as deleting an absent element or inserting at an index
+// out of range, Apply returns an error identifying it and leaves the set unchanged, since the
+// operations are applied to a copy that replaces the set once all of them succeed. In a set
+// created with NewSorted, inserted elements are placed at their sorted position and moves
+// have no effect.
+func (s *OrderedSet[T]) Apply(ops []EditOp[T]) error {
+	return s.Transaction(func(tx *OrderedSet[T]) error {
+		tx.lock()
+		defer tx.unlock()
+		for i, op := range ops {
+			if err := tx.edit(op); err != nil {
+				return fmt.Errorf("operation %d: %w", i, err)
+			}
+		}
+		return nil
+	})
 }
 
-// New creates a new empty OrderedSet.
-func New[T comparable]() *OrderedSet[T] {
-	return &OrderedSet[T]{
-		index:  make(map[T]struct{}),
-		values: make([]T, 0),
+// edit applies a single operation of an edit script.
+// The caller must hold the write lock.
+func (s *OrderedSet[T]) edit(op EditOp[T]) error {
+	i, exists := s.pos(op.Value)
+	switch op.Kind {
+	case EditInsert:
+		if exists {
+			return fmt.Errorf("insert %v: %w", op.Value, ErrAlreadyPresent)
+		}
+		if op.Index < 0 || op.Index > len(s.values) {
+			return fmt.Errorf("insert %v at index %d: %w", op.Value, op.Index, ErrIndexOutOfRange)
+		}
+		if s.validate != nil {
+			if err := s.validate(op.Value); err != nil {
+				return fmt.Errorf("insert %v: %w", op.Value, err)
+			}
+		}
+		if s.less != nil {
+			s.add(op.Value)
+			return nil
+		}
+		v, _ := s.admit(op.Value)
+		s.values = slices.Insert(s.values, op.Index, v)
+		s.reindex(op.Index)
+		s.stamp(v)
+		s.evict()
+	case EditDelete:
+		if !exists {
+			return fmt.Errorf("delete %v: %w", op.Value, ErrNotFound)
+		}
+		s.removeAt(i)
+	case EditMove:
+		if !exists {
+			return fmt.Errorf("move %v: %w", op.Value, ErrNotFound)
+		}
+		if op.Index < 0 || op.Index >= len(s.values) {
+			return fmt.Errorf("move %v to index %d: %w", op.Value, op.Index, ErrIndexOutOfRange)
+		}
+		if s.less == nil {
+			s.move(i, op.Index)
+		}
+	default:
+		return fmt.Errorf("unknown edit kind %v", op.Kind)
 	}
+	return nil
 }
 
-// Add inserts a value into the set if it is not already present.
-func (s *OrderedSet[T]) Add(value T) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, exists := s.index[value]; !exists {
-		s.index[value] = struct{}{}
-		s.values = append(s.values, value)
+// longestIncreasing returns the indices of a longest strictly increasing subsequence of seq.
+func longestIncreasing(seq []int) []int {
+	var tails []int
+	prev := make([]int, len(seq))
+	for i, x := range seq {
+		k := sort.Search(len(tails), func(k int) bool { return seq[tails[k]] >= x })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	if len(tails) == 0 {
+		return nil
 	}
+	run := make([]int, len(tails))
+	for k, i := len(tails)-1, tails[len(tails)-1]; k >= 0; k, i = k-1, prev[i] {
+		run[k] = i
+	}
+	return run
 }
 
-// Remove deletes a value from the set.
-func (s *OrderedSet[T]) Remove(value T) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, exists := s.index[value]; exists {
-		delete(s.index, value)
-		for i, v := range s.values {
-			if v == value {
-				s.values = append(s.values[:i], s.values[i+1:]...)
-				break
-			}
+// CommonPrefix returns a new set with the leading elements that both sets hold at the same
+// positions, up to the first position where they differ.
+func (s *OrderedSet[T]) CommonPrefix(other *OrderedSet[T]) *OrderedSet[T] {
+	if other == s {
+		return s.Clone()
+	}
+	defer s.lockWith(other, false)()
+	n := 0
+	for n < len(s.values) && n < len(other.values) && s.values[n] == other.values[n] {
+		n++
+	}
+	return s.slice(0, n)
+}
+
+// Jaccard returns the Jaccard similarity of the two sets: the size of their intersection
+// divided by the size of their union. Two empty sets have a similarity of 1.
+func (s *OrderedSet[T]) Jaccard(other *OrderedSet[T]) float64 {
+	if other == s {
+		return 1
+	}
+	defer s.lockWith(other, false)()
+	var common int
+	for _, v := range s.values {
+		if _, exists := other.pos(v); exists {
+			common++
 		}
 	}
+	union := len(s.values) + len(other.values) - common
+	if union == 0 {
+		return 1
+	}
+	return float64(common) / float64(union)
 }
 
-// RemoveAt deletes a value by index and returns it. If index is invalid, ok is false.
-func (s *OrderedSet[T]) RemoveAt(index int) (val T, ok bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if index < 0 || index >= len(s.values) {
-		var zero T
-		return zero, false
+// retain keeps only the elements for which keep returns true, in a single filtering pass,
+// and returns the number of elements removed. The caller must hold the write lock.
+func (s *OrderedSet[T]) retain(keep func(T) bool) int {
+	s.fold()
+	s.gaps = s.gaps[:0]
+	values := s.values[:0]
+	for _, v := range s.values {
+		if keep(v) {
+			s.index[v] = len(values)
+			values = append(values, v)
+		} else {
+			delete(s.index, v)
+			delete(s.pinned, v)
+			delete(s.handles, v)
+			delete(s.stamps, v)
+		}
 	}
-	val = s.values[index]
-	s.values = append(s.values[:index], s.values[index+1:]...)
-	delete(s.index, val)
-	return val, true
+	removed := len(s.values) - len(values)
+	clear(s.values[len(values):])
+	s.values = values
+	s.shrink()
+	return removed
 }
 
-// Has reports whether the set contains the given value.
-func (s *OrderedSet[T]) Has(value T) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	_, exists := s.index[value]
-	return exists
+// Slice returns a new set containing elements from index "from" (inclusive) to "to" (exclusive).
+// Returns an error if indices are out of range or invalid.
+func (s *OrderedSet[T]) Slice(from, to int) (*OrderedSet[T], error) {
+	s.rlock()
+	defer s.runlock()
+
+	if from < 0 {
+		return nil, fmt.Errorf("from index %d is negative: %w", from, ErrIndexOutOfRange)
+	}
+	if to > len(s.values) {
+		return nil, fmt.Errorf("to index %d: %w", to, ErrIndexOutOfRange)
+	}
+	if from > to {
+		return nil, fmt.Errorf("from index %d is greater than to index %d: %w", from, to, ErrInvalidRange)
+	}
+
+	return s.slice(from, to), nil
 }
 
-// Len returns the number of elements in the set.
-func (s *OrderedSet[T]) Len() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.values)
+// Page returns up to limit elements starting at offset, together with the total number of
+// elements, both read under a single lock so that they are consistent with each other.
+// A page extending past the end is cut short, and an offset beyond the end yields no
+// elements. Returns an error if offset or limit is negative.
+func (s *OrderedSet[T]) Page(offset, limit int) (items []T, total int, err error) {
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("offset %d is negative: %w", offset, ErrIndexOutOfRange)
+	}
+	if limit < 0 {
+		return nil, 0, fmt.Errorf("limit %d is negative: %w", limit, ErrInvalidRange)
+	}
+
+	s.rlock()
+	defer s.runlock()
+	total = len(s.values)
+	from := min(offset, total)
+	to := from + min(limit, total-from)
+	items = make([]T, to-from)
+	copy(items, s.values[from:to])
+	return items, total, nil
 }
 
-// Values returns a copy of the values in insertion order.
-func (s *OrderedSet[T]) Values() []T {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	valuesCopy := make([]T, len(s.values))
-	copy(valuesCopy, s.values)
-	return valuesCopy
+// SplitAt returns two sets: left holds the elements before index and right holds the
+// elements from index onwards, both in insertion order.
+// Returns an error if index is out of range.
+func (s *OrderedSet[T]) SplitAt(index int) (left, right *OrderedSet[T], err error) {
+	s.rlock()
+	defer s.runlock()
+
+	if index < 0 || index > len(s.values) {
+		return nil, nil, fmt.Errorf("index %d: %w", index, ErrIndexOutOfRange)
+	}
+
+	return s.slice(0, index), s.slice(index, len(s.values)), nil
 }
 
-// At returns the element at the given index.
-func (s *OrderedSet[T]) At(index int) (T, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	if index < 0 || index >= len(s.values) {
-		var zero T
-		return zero, false
+// SplitBy returns two sets: lo holds the elements for which less(element, pivot) is true and
+// hi holds the rest, both in insertion order.
+// less must not use the set, which would deadlock.
+func (s *OrderedSet[T]) SplitBy(pivot T, less func(a, b T) bool) (lo, hi *OrderedSet[T]) {
+	s.rlock()
+	defer s.runlock()
+	lo, hi = New[T](), New[T]()
+	for _, v := range s.values {
+		if less(v, pivot) {
+			lo.add(v)
+		} else {
+			hi.add(v)
+		}
 	}
-	return s.values[index], true
+	return lo, hi
 }
 
-// IndexOf returns the index of the given value, or -1 if not found.
-func (s *OrderedSet[T]) IndexOf(value T) int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// TakeWhile returns a new set with the leading elements that satisfy pred, in order,
+// stopping at the first element that does not.
+// pred must not use the set, which would deadlock.
+func (s *OrderedSet[T]) TakeWhile(pred func(T) bool) *OrderedSet[T] {
+	s.rlock()
+	defer s.runlock()
+	return s.slice(0, s.leading(pred))
+}
+
+// DropWhile returns a new set with the elements that follow the leading elements satisfying
+// pred, in order, starting at the first element that does not satisfy it.
+// pred must not use the set, which would deadlock.
+func (s *OrderedSet[T]) DropWhile(pred func(T) bool) *OrderedSet[T] {
+	s.rlock()
+	defer s.runlock()
+	return s.slice(s.leading(pred), len(s.values))
+}
+
+// leading returns the number of leading elements that satisfy pred.
+// The caller must hold the read lock.
+func (s *OrderedSet[T]) leading(pred func(T) bool) int {
 	for i, v := range s.values {
-		if v == value {
+		if !pred(v) {
 			return i
 		}
 	}
-	return -1
+	return len(s.values)
 }
 
-// SortBy sorts the elements of the set in-place using the provided less function.
-func (s *OrderedSet[T]) SortBy(less func(a, b T) bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	sort.Slice(s.values, func(i, j int) bool {
-		return less(s.values[i], s.values[j])
-	})
+// slice returns a new set containing elements from index "from" (inclusive) to "to" (exclusive).
+// The caller must hold the read lock and validate the indices.
+func (s *OrderedSet[T]) slice(from, to int) *OrderedSet[T] {
+	result := New[T]()
+	for _, v := range s.values[from:to] {
+		result.add(v)
+	}
+	return result
 }
 
-// Clone returns a new copy of the set.
-func (s *OrderedSet[T]) Clone() *OrderedSet[T] {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	clone := New[T]()
-	for _, v := range s.values {
-		clone.index[v] = struct{}{}
-		clone.values = append(clone.values, v)
+// ZipWith returns a new set holding f applied to the i-th elements of a and b, in order.
+// When the sets have different lengths, zipping stops at the end of the shorter one.
+// Results that f maps to the same value are kept once, at their first position.
+func ZipWith[T, U, V comparable](a *OrderedSet[T], b *OrderedSet[U], f func(T, U) V) *OrderedSet[V] {
+	aValues, bValues := a.Values(), b.Values()
+	n := min(len(aValues), len(bValues))
+	result := New[V]()
+	for i := range n {
+		result.add(f(aValues[i], bValues[i]))
 	}
-	return clone
+	return result
 }
 
-// Union returns a new set containing all elements from both sets.
-func (s *OrderedSet[T]) Union(other *OrderedSet[T]) *OrderedSet[T] {
-	result := s.Clone()
-	for _, v := range other.Values() {
-		result.Add(v)
+// MapSeq returns an iterator over f applied to the elements of s, in order. f is called
+// lazily as the iterator is consumed, over a snapshot of s taken when iteration starts.
+// Results may repeat; pass the iterator to Collect to build a set of them.
+func MapSeq[T, U comparable](s *OrderedSet[T], f func(T) U) iter.Seq[U] {
+	return func(yield func(U) bool) {
+		for _, v := range s.Values() {
+			if !yield(f(v)) {
+				return
+			}
+		}
+	}
+}
+
+// FilterMap returns a new set holding f applied to the elements of s, in order, keeping only
+// the results for which f also returns true. Results that repeat are kept once, at their
+// first position.
+func FilterMap[T, U comparable](s *OrderedSet[T], f func(T) (U, bool)) *OrderedSet[U] {
+	result := New[U]()
+	for _, v := range s.Values() {
+		if u, ok := f(v); ok {
+			result.add(u)
+		}
 	}
 	return result
 }
 
-// Intersect returns a new set with elements common to both sets.
-func (s *OrderedSet[T]) Intersect(other *OrderedSet[T]) *OrderedSet[T] {
+// WalkNested visits the elements of root and, depth first, the elements of the sets that
+// children returns for them, each element before its children. visit receives the path of
+// ancestors leading to value, which it must not retain as it is reused, and the walk stops
+// as soon as visit returns false. children may return nil for an element without children.
+// An element already on the current path is skipped, so cycles do not loop forever, while an
+// element reachable through several paths is visited once per path.
+func WalkNested[T comparable](root *OrderedSet[T], children func(T) *OrderedSet[T], visit func(path []T, value T) bool) {
+	onPath := make(map[T]bool)
+	var walk func(set *OrderedSet[T], path []T) bool
+	walk = func(set *OrderedSet[T], path []T) bool {
+		for _, v := range set.Values() {
+			if onPath[v] {
+				continue
+			}
+			if !visit(path, v) {
+				return false
+			}
+			if child := children(v); child != nil {
+				onPath[v] = true
+				ok := walk(child, append(path, v))
+				delete(onPath, v)
+				if !ok {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	walk(root, nil)
+}
+
+// Origin tells which of two compared sets an element belongs to.
+type Origin int
+
+const (
+	// OnlyA marks an element present only in the first set.
+	OnlyA Origin = iota
+	// OnlyB marks an element present only in the second set.
+	OnlyB
+	// Both marks an element present in both sets.
+	Both
+)
+
+// String returns the name of the origin.
+func (o Origin) String() string {
+	switch o {
+	case OnlyA:
+		return "OnlyA"
+	case OnlyB:
+		return "OnlyB"
+	case Both:
+		return "Both"
+	}
+	return fmt.Sprintf("Origin(%d)", int(o))
+}
+
+// Classified is an element annotated with the sets it belongs to.
+type Classified[T any] struct {
+	Value  T
+	Origin Origin
+}
+
+// Classify returns every element of a and b, annotated with its origin. The elements of a
+// come first, in a's order, followed by the elements only in b, in b's order.
+func Classify[T comparable](a, b *OrderedSet[T]) []Classified[T] {
+	if a == b {
+		a.rlock()
+		defer a.runlock()
+		result := make([]Classified[T], len(a.values))
+		for i, v := range a.values {
+			result[i] = Classified[T]{Value: v, Origin: Both}
+		}
+		return result
+	}
+	defer a.lockWith(b, false)()
+	result := make([]Classified[T], 0, len(a.values)+len(b.values))
+	for _, v := range a.values {
+		origin := OnlyA
+		if _, exists := b.pos(v); exists {
+			origin = Both
+		}
+		result = append(result, Classified[T]{Value: v, Origin: origin})
+	}
+	for _, v := range b.values {
+		if _, exists := a.pos(v); !exists {
+			result = append(result, Classified[T]{Value: v, Origin: OnlyB})
+		}
+	}
+	return result
+}
+
+// Flatten returns a new set with the elements of all given sets. Each element appears once,
+// at the position of its first occurrence when the sets are read in order.
+func Flatten[T comparable](sets ...*OrderedSet[T]) *OrderedSet[T] {
 	result := New[T]()
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	for _, v := range s.values {
-		if other.Has(v) {
-			result.Add(v)
+	for _, set := range sets {
+		for _, v := range set.Values() {
+			result.add(v)
 		}
 	}
 	return result
 }
 
-// Difference returns a new set with elements in s that are not in other.
-func (s *OrderedSet[T]) Difference(other *OrderedSet[T]) *OrderedSet[T] {
+// FlattenSlices returns a new set with the elements of all given slices. Each element appears
+// once, at the position of its first occurrence when the slices are read in order.
+func FlattenSlices[T comparable](lists ...[]T) *OrderedSet[T] {
 	result := New[T]()
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	for _, v := range s.values {
-		if !other.Has(v) {
-			result.Add(v)
+	for _, values := range lists {
+		for _, v := range values {
+			result.add(v)
 		}
 	}
 	return result
 }
 
-// Slice returns a new set containing elements from index "from" (inclusive) to "to" (exclusive).
-// Returns an error if indices are out of range or invalid.
-func (s *OrderedSet[T]) Slice(from, to int) (*OrderedSet[T], error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// IntersectionCounts returns every element of the given sets, in the order elements first
+// appeared, together with the number of sets containing each element. Elements whose count
+// equals len(sets) form the intersection of all sets.
+func IntersectionCounts[T comparable](sets ...*OrderedSet[T]) (*OrderedSet[T], map[T]int) {
+	result := New[T]()
+	counts := make(map[T]int)
+	for _, set := range sets {
+		for _, v := range set.Values() {
+			result.add(v)
+			counts[v]++
+		}
+	}
+	return result, counts
+}
 
-	if from < 0 {
-		return nil, fmt.Errorf("from index %d is negative", from)
+// AtLeast returns a new set with the elements present in at least k of the given sets,
+// in the order elements first appeared.
+func AtLeast[T comparable](k int, sets ...*OrderedSet[T]) *OrderedSet[T] {
+	all, counts := IntersectionCounts(sets...)
+	result := New[T]()
+	for _, v := range all.values {
+		if counts[v] >= k {
+			result.add(v)
+		}
 	}
-	if to > len(s.values) {
-		return nil, fmt.Errorf("to index %d is out of range", to)
+	return result
+}
+
+// Scan returns the successive results of folding the elements into init with f, in insertion
+// order: the i-th result is f applied to the (i-1)-th result, or init, and the i-th element.
+// f must not use the set, which would deadlock.
+func Scan[T comparable, A any](s *OrderedSet[T], init A, f func(acc A, v T) A) []A {
+	s.rlock()
+	defer s.runlock()
+	results := make([]A, len(s.values))
+	acc := init
+	for i, v := range s.values {
+		acc = f(acc, v)
+		results[i] = acc
 	}
-	if from > to {
-		return nil, fmt.Errorf("from index %d is greater than to index %d", from, to)
+	return results
+}
+
+// Histogram returns the distinct keys of the elements, in order of first appearance, and the
+// number of elements sharing each key.
+// keyFn must not use the set, which would deadlock.
+func Histogram[T comparable, K comparable](s *OrderedSet[T], keyFn func(T) K) (*OrderedSet[K], map[K]int) {
+	s.rlock()
+	defer s.runlock()
+	keys := New[K]()
+	counts := make(map[K]int)
+	for _, v := range s.values {
+		key := keyFn(v)
+		keys.add(key)
+		counts[key]++
 	}
+	return keys, counts
+}
 
-	result := New[T]()
-	for _, v := range s.values[from:to] {
-		result.Add(v)
+// CountRuns returns the number of maximal runs of consecutive elements sharing the same key,
+// in insertion order. For example, elements with keys A, A, B, A form 3 runs.
+// keyFn must not use the set, which would deadlock.
+func CountRuns[T comparable, K comparable](s *OrderedSet[T], keyFn func(T) K) int {
+	s.rlock()
+	defer s.runlock()
+	var runs int
+	var prev K
+	for i, v := range s.values {
+		key := keyFn(v)
+		if i == 0 || key != prev {
+			runs++
+		}
+		prev = key
+	}
+	return runs
+}
+
+// SetStrict enables or disables strict mode. In strict mode UnmarshalJSON returns an error
+// when the incoming array contains duplicates instead of silently dropping them.
+func (s *OrderedSet[T]) SetStrict(strict bool) {
+	s.lock()
+	defer s.unlock()
+	s.strict = strict
+}
+
+// SetElementCodec sets the functions used to encode and decode individual elements
+// in MarshalJSON, UnmarshalJSON, EncodeJSON and DecodeJSON. Passing nil functions
+// restores the default encoding/json representation of T.
+func (s *OrderedSet[T]) SetElementCodec(enc func(T) (json.RawMessage, error), dec func(json.RawMessage) (T, error)) {
+	s.lock()
+	defer s.unlock()
+	s.enc = enc
+	s.dec = dec
+}
+
+// encodeElement encodes a single element as json.Marshal encodes it within a slice: through
+// a pointer, so that marshalers with pointer receivers are used, or with the element codec,
+// if set, whose output is validated and compacted like a json.RawMessage.
+// The caller must hold the read lock.
+func (s *OrderedSet[T]) encodeElement(v *T) ([]byte, error) {
+	if s.enc != nil {
+		b, err := s.enc(*v)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(json.RawMessage(b))
+	}
+	return json.Marshal(v)
+}
+
+// encodesAsString reports whether encoding/json encodes a slice of T as a base64 string,
+// as it does for bytes without marshalers of their own.
+func encodesAsString[T any]() bool {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Uint8 {
+		return false
+	}
+	p := reflect.PointerTo(t)
+	return !p.Implements(reflect.TypeFor[json.Marshaler]()) &&
+		!p.Implements(reflect.TypeFor[encoding.TextMarshaler]())
+}
+
+// decodeElement decodes a single element using the element codec, if set.
+func decodeElement[T comparable](dec func(json.RawMessage) (T, error), data []byte) (T, error) {
+	if dec != nil {
+		return dec(data)
 	}
-	return result, nil
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
 }
 
-// MarshalJSON implements json.Marshaler.
+// MarshalJSON implements json.Marshaler. An empty set, including the zero value, is encoded
+// as an empty array. A set held by value in a struct field is only encoded with this method
+// when the struct is addressable, such as when a pointer to it is passed to json.Marshal.
 func (s *OrderedSet[T]) MarshalJSON() ([]byte, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return json.Marshal(s.values)
+	s.rlock()
+	defer s.runlock()
+	return s.marshalJSON()
+}
+
+// marshalJSON encodes the set as a JSON array.
+// The caller must hold the read lock.
+func (s *OrderedSet[T]) marshalJSON() ([]byte, error) {
+	if s.enc == nil {
+		if s.values == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(s.values)
+	}
+	raw := make([]json.RawMessage, len(s.values))
+	for i, v := range s.values {
+		b, err := s.enc(v)
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = b
+	}
+	return json.Marshal(raw)
+}
+
+// EncodeJSON writes the set to w as a JSON array, encoding one element at a time,
+// so that the whole encoded array is never held in memory. The output matches MarshalJSON,
+// so a set of bytes is written in one piece as a base64 string. The read lock is held until encoding completes, so the output is consistent.
+func (s *OrderedSet[T]) EncodeJSON(w io.Writer) error {
+	s.rlock()
+	defer s.runlock()
+	if s.enc == nil && encodesAsString[T]() {
+		b, err := s.marshalJSON()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := range s.values {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		b, err := s.encodeElement(&s.values[i])
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// SameJSON reports whether s and other are encoded by MarshalJSON as the same bytes.
+// Sets holding equal elements in the same order are compared without being encoded, unless
+// equal elements may be encoded differently, as 0.0 and -0.0 are.
+func (s *OrderedSet[T]) SameJSON(other *OrderedSet[T]) (bool, error) {
+	if other == s {
+		return true, nil
+	}
+	defer s.lockWith(other, false)()
+	if s.enc == nil && other.enc == nil && encodesEqualAlike(reflect.TypeFor[T]()) &&
+		slices.Equal(s.values, other.values) {
+		return true, nil
+	}
+	a, err := s.marshalJSON()
+	if err != nil {
+		return false, err
+	}
+	b, err := other.marshalJSON()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(a, b), nil
+}
+
+// encodesEqualAlike reports whether equal values of type t are always encoded by
+// encoding/json as the same bytes. It is false for types holding floating-point numbers,
+// whose zeros compare equal but are encoded as 0 and -0, for interfaces, which may hold them,
+// and for types that cannot be encoded, so that the encoding error is reported.
+func encodesEqualAlike(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+		reflect.Interface, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return false
+	case reflect.Array:
+		return encodesEqualAlike(t.Elem())
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if !encodesEqualAlike(t.Field(i).Type) {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
+// Duplicates are dropped, unless the set is in strict mode, in which case an error is returned
+// and the set is left unchanged. Elements rejected by the validator always cause an error.
+// Use json.Number as the element type to preserve the exact textual form of numbers, since
+// float64 elements are re-encoded in their shortest form.
 func (s *OrderedSet[T]) UnmarshalJSON(data []byte) error {
+	if s == nil {
+		return errors.New("orderedset: UnmarshalJSON on nil pointer")
+	}
+	s.rlock()
+	dec := s.dec
+	s.runlock()
+
 	var raw []T
-	if err := json.Unmarshal(data, &raw); err != nil {
+	if dec == nil {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	} else {
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return err
+		}
+		raw = make([]T, len(elements))
+		for i, element := range elements {
+			v, err := dec(element)
+			if err != nil {
+				return err
+			}
+			raw[i] = v
+		}
+	}
+
+	s.lock()
+	defer s.unlock()
+	if s.validate != nil {
+		for i, v := range raw {
+			if err := s.validate(v); err != nil {
+				return fmt.Errorf("element at index %d: %w", i, err)
+			}
+		}
+	}
+	return s.replace(raw, s.strict)
+}
+
+// DecodeJSON replaces the contents of the set with the elements of the JSON array read from r.
+// Elements are decoded one at a time, so the array is never fully materialized in memory.
+// A set of bytes also accepts the base64 string that MarshalJSON writes for it. Duplicates and invalid elements are handled as in UnmarshalJSON. On error the set is left
+// unchanged. On a set created with WithBounded, the distinct elements decoded so far are
+// kept aside, so that duplicates of evicted elements are still detected.
+func (s *OrderedSet[T]) DecodeJSON(r io.Reader) error {
+	s.rlock()
+	decoded := &OrderedSet[T]{
+		index:    make(map[T]int),
+		values:   make([]T, 0),
+		strict:   s.strict,
+		less:     s.less,
+		max:      s.max,
+		validate: s.validate,
+		intern:   s.intern,
+	}
+	dec := s.dec
+	s.runlock()
+
+	// A bounded set forgets evicted elements, so duplicates of them are detected separately.
+	var seen map[T]struct{}
+	if decoded.max > 0 {
+		seen = make(map[T]struct{})
+	}
+	insert := func(i int, v T) error {
+		if decoded.validate != nil {
+			if err := decoded.validate(v); err != nil {
+				return fmt.Errorf("element at index %d: %w", i, err)
+			}
+		}
+		if seen != nil {
+			if _, exists := seen[v]; exists {
+				if decoded.strict {
+					return fmt.Errorf("duplicate element at index %d", i)
+				}
+				return nil
+			}
+			seen[v] = struct{}{}
+		}
+		if !decoded.add(v) && decoded.strict {
+			return fmt.Errorf("duplicate element at index %d", i)
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(r)
+	tok, err := decoder.Token()
+	if err != nil {
 		return err
 	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.index = make(map[T]struct{}, len(raw))
-	s.values = make([]T, 0, len(raw))
-	for _, v := range raw {
-		if _, exists := s.index[v]; !exists {
-			s.index[v] = struct{}{}
-			s.values = append(s.values, v)
+	if str, ok := tok.(string); ok && dec == nil && encodesAsString[T]() {
+		data, err := json.Marshal(str)
+		if err != nil {
+			return err
+		}
+		var raw []T
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		for i, v := range raw {
+			if err := insert(i, v); err != nil {
+				return err
+			}
+		}
+	} else {
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return fmt.Errorf("expected JSON array, got %v", tok)
+		}
+		for i := 0; decoder.More(); i++ {
+			var element json.RawMessage
+			if err := decoder.Decode(&element); err != nil {
+				return err
+			}
+			v, err := decodeElement(dec, element)
+			if err != nil {
+				return err
+			}
+			if err := insert(i, v); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
 		}
 	}
+
+	s.lock()
+	defer s.unlock()
+	s.index = decoded.index
+	s.base = nil
+	s.gaps = decoded.gaps
+	s.values = decoded.values
+	s.handles = decoded.handles
+	s.prunePins()
+	s.restamp()
 	return nil
 }
+
+// MarshalText implements encoding.TextMarshaler, writing the text form of each element on
+// its own line, in order. Elements implementing encoding.TextMarshaler are written with it,
+// and other elements are formatted with fmt's %v verb.
+func (s *OrderedSet[T]) MarshalText() ([]byte, error) {
+	record, err := s.MarshalCSVRecord()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join(record, "\n")), nil
+}
+
+// MarshalCSVRecord returns the text form of each element, in order, as a record that can be
+// written with csv.Writer. Elements are converted as in MarshalText.
+func (s *OrderedSet[T]) MarshalCSVRecord() ([]string, error) {
+	s.rlock()
+	defer s.runlock()
+	record := make([]string, len(s.values))
+	for i, v := range s.values {
+		text, err := elementText(v)
+		if err != nil {
+			return nil, fmt.Errorf("element at index %d: %w", i, err)
+		}
+		record[i] = text
+	}
+	return record, nil
+}
+
+// elementText returns the text form of v, using its MarshalText method if it has one.
+func elementText[T any](v T) (string, error) {
+	if m, ok := any(v).(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	return fmt.Sprintf("%v", v), nil
+}
+
+// MarshalCompressed returns the set's JSON encoding compressed with gzip. The encoding is
+// written by EncodeJSON, whose output matches MarshalJSON.
+func (s *OrderedSet[T]) MarshalCompressed() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := s.EncodeJSON(zw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalCompressed decompresses data produced by MarshalCompressed and replaces the
+// contents of the set with the decoded elements, following the rules of UnmarshalJSON.
+func (s *OrderedSet[T]) UnmarshalCompressed(data []byte) error {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	return s.UnmarshalJSON(raw)
+}
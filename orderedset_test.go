@@ -1,268 +1,3105 @@
 package orderedset_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
 	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/babenkoivan/orderedset"
 )
 
-func TestAdd(t *testing.T) {
-	s := orderedset.New[int]()
-	s.Add(1)
-	s.Add(2)
-	s.Add(2)
+func TestNewExpiring(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := orderedset.NewExpiring[string](time.Minute, func() time.Time { return now })
+	s.Add("a")
+	now = now.Add(30 * time.Second)
+	s.Add("b")
+	s.Add("c")
 
-	expected := []int{1, 2}
+	now = now.Add(20 * time.Second)
+	s.Add("a")
+	now = now.Add(20 * time.Second)
+	if l := s.Len(); l != 3 {
+		t.Errorf("NewExpiring failed: got length %d, want 3", l)
+	}
+
+	now = now.Add(25 * time.Second)
+	if s.Has("b") {
+		t.Error("NewExpiring failed: expected b to have expired")
+	}
+	expected := []string{"a"}
 	if !reflect.DeepEqual(s.Values(), expected) {
-		t.Errorf("Add failed: got %v, want %v", s.Values(), expected)
+		t.Errorf("NewExpiring failed: got %v, want %v", s.Values(), expected)
 	}
-}
 
-func TestHas(t *testing.T) {
-	s := orderedset.New[int]()
-	s.Add(1)
+	now = now.Add(time.Minute)
+	if !s.IsEmpty() || s.NonEmpty() {
+		t.Error("NewExpiring failed: expected IsEmpty to exclude expired elements")
+	}
+	if v, ok := s.At(0); ok {
+		t.Errorf("NewExpiring failed: At(0) got %q, want no element", v)
+	}
+	if s.Len() != 0 || s.Has("a") {
+		t.Errorf("NewExpiring failed: got %v, want []", s.Values())
+	}
 
-	if !s.Has(1) {
-		t.Error("Has failed: expected true for 1")
+	s.Add("d")
+	s.Add("e")
+	now = now.Add(30 * time.Second)
+	s.Add("d")
+	now = now.Add(40 * time.Second)
+	if n, values := s.LenAndValues(); n != 1 || !reflect.DeepEqual(values, []string{"d"}) {
+		t.Errorf("LenAndValues failed: got %d and %v, want 1 and [d]", n, values)
 	}
-	if s.Has(2) {
-		t.Error("Has failed: expected false for 2")
+	if got := s.HasEach([]string{"d", "e"}); !reflect.DeepEqual(got, []bool{true, false}) {
+		t.Errorf("HasEach failed: got %v, want [true false]", got)
 	}
 }
 
-func TestRemove(t *testing.T) {
-	s := orderedset.New[int]()
+func TestNewExpiringReplacements(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	s := orderedset.NewExpiring[int](time.Minute, clock)
 	s.Add(1)
-	s.Add(2)
 
-	s.Remove(1)
-	if s.Has(1) {
-		t.Error("Remove failed: 1 should be removed")
+	now = now.Add(30 * time.Second)
+	if err := s.Apply([]orderedset.EditOp[int]{{Kind: orderedset.EditDelete, Value: 1}}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	now = now.Add(20 * time.Second)
+	if err := s.Apply([]orderedset.EditOp[int]{{Kind: orderedset.EditInsert, Value: 1}}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	now = now.Add(15 * time.Second)
+	if !s.Has(1) {
+		t.Error("Apply failed: expected the reinserted element to be live")
 	}
 
-	s.Remove(3)
-	if s.Len() != 1 {
-		t.Error("Remove failed: length should remain 1 after removing non-existing")
+	err := s.Transaction(func(tx *orderedset.OrderedSet[int]) error {
+		tx.Add(2)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	now = now.Add(50 * time.Second)
+	if expected := []int{2}; !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Transaction failed: got %v, want %v", s.Values(), expected)
+	}
+
+	other := orderedset.NewExpiring[int](time.Minute, clock)
+	other.Add(3)
+	orderedset.Swap(s, other)
+	now = now.Add(45 * time.Second)
+	if !s.Has(3) || other.Has(2) {
+		t.Errorf("Swap failed: got %v and %v, want [3] and []", s.Values(), other.Values())
 	}
 }
 
-func TestRemoveAt(t *testing.T) {
-	s := orderedset.New[int]()
-	s.Add(10)
-	s.Add(20)
+func TestNewExpiringInsertions(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := orderedset.NewExpiring[int](time.Minute, func() time.Time { return now })
+	s.Add(1)
+	if err := s.InsertSetAt(0, orderedset.New(orderedset.WithInitial(2))); err != nil {
+		t.Fatalf("InsertSetAt failed: %v", err)
+	}
+	s.Update(1, 3)
 
-	val, ok := s.RemoveAt(1)
-	if !ok || val != 20 {
-		t.Errorf("RemoveAt failed: got (%v, %v), want (20, true)", val, ok)
+	now = now.Add(2 * time.Minute)
+	if s.Has(2) || s.Has(3) {
+		t.Errorf("NewExpiring failed: got %v, want elements from InsertSetAt and Update expired", s.Values())
 	}
 
-	val, ok = s.RemoveAt(5)
-	if ok {
-		t.Error("RemoveAt failed: expected false for invalid index")
+	s.Add(4)
+	now = now.Add(2 * time.Minute)
+	if has, err := s.HasContext(context.Background(), 4); err != nil || has {
+		t.Errorf("HasContext failed: got %v, %v, want false, nil for an expired element", has, err)
 	}
 }
 
-func TestAt(t *testing.T) {
-	s := orderedset.New[int]()
-	s.Add(5)
+func TestNewExpiringWrites(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := orderedset.NewExpiring[string](10*time.Second, func() time.Time { return now })
+	s.Add("a")
+	now = now.Add(6 * time.Second)
+	s.Add("b")
+	now = now.Add(6 * time.Second)
+	s.Add("a")
+	if expected := []string{"b", "a"}; !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Add failed: got %v, want %v for a re-added expired element", s.Values(), expected)
+	}
 
-	val, ok := s.At(0)
-	if !ok || val != 5 {
-		t.Errorf("At failed: got (%v, %v), want (5, true)", val, ok)
+	now = now.Add(20 * time.Second)
+	if s.Take("a") {
+		t.Error("Take failed: expected false for an expired element")
+	}
+	if stored, loaded := s.GetOrAdd("b"); stored != "b" || loaded {
+		t.Errorf("GetOrAdd failed: got %q, %v, want b, false for an expired element", stored, loaded)
+	}
+	if expected := []string{"b"}; !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("GetOrAdd failed: got %v, want %v", s.Values(), expected)
 	}
 
-	_, ok = s.At(1)
-	if ok {
-		t.Error("At failed: expected false for out of range index")
+	s.Add("c")
+	now = now.Add(20 * time.Second)
+	s.Add("d")
+	if s.Update("b", "e") {
+		t.Error("Update failed: expected false for an expired element")
+	}
+	if !s.Update("d", "c") {
+		t.Error("Update failed: expected an expired replacement to be treated as absent")
+	}
+	if expected := []string{"c"}; !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Update failed: got %v, want %v", s.Values(), expected)
 	}
 }
 
-func TestIndexOf(t *testing.T) {
-	s := orderedset.New[int]()
-	s.Add(5)
-	s.Add(10)
+func TestNewExpiringReads(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := orderedset.NewExpiring[int](time.Minute, func() time.Time { return now })
+	s.Add(1)
+	s.Add(2)
+	now = now.Add(2 * time.Minute)
 
-	if idx := s.IndexOf(10); idx != 1 {
-		t.Errorf("IndexOf failed: got %d, want 1", idx)
+	if values, err := s.ValuesContext(context.Background()); err != nil || len(values) != 0 {
+		t.Errorf("ValuesContext failed: got %v, %v, want [], nil", values, err)
 	}
-
-	if idx := s.IndexOf(15); idx != -1 {
-		t.Errorf("IndexOf failed: got %d, want -1", idx)
+	s.Add(3)
+	now = now.Add(2 * time.Minute)
+	if data, err := s.MarshalJSON(); err != nil || string(data) != "[]" {
+		t.Errorf("MarshalJSON failed: got %s, %v, want [], nil", data, err)
+	}
+	s.Add(4)
+	now = now.Add(2 * time.Minute)
+	var buf bytes.Buffer
+	if err := s.EncodeJSON(&buf); err != nil || buf.String() != "[]" {
+		t.Errorf("EncodeJSON failed: got %s, %v, want [], nil", buf.String(), err)
+	}
+	s.Add(5)
+	now = now.Add(2 * time.Minute)
+	if v, ok := s.RemoveAt(0); ok {
+		t.Errorf("RemoveAt failed: got %d, want no element", v)
+	}
+	s.Add(6)
+	now = now.Add(2 * time.Minute)
+	if popped := s.PopN(1); len(popped) != 0 {
+		t.Errorf("PopN failed: got %v, want []", popped)
 	}
 }
 
-func TestLen(t *testing.T) {
-	s := orderedset.New[int]()
-	if l := s.Len(); l != 0 {
-		t.Errorf("Len failed: got %d, want 0", l)
+func TestCollect(t *testing.T) {
+	countdown := func(yield func(int) bool) {
+		for i := 3; i > 0; i-- {
+			if !yield(i) || !yield(i) {
+				return
+			}
+		}
 	}
 
-	s.Add(1)
-	if l := s.Len(); l != 1 {
-		t.Errorf("Len failed: got %d, want 1", l)
+	s := orderedset.Collect(countdown)
+	expected := []int{3, 2, 1}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Collect failed: got %v, want %v", s.Values(), expected)
+	}
+
+	s = orderedset.Collect(slices.Values([]int{1, 2, 1, 3}))
+	expected = []int{1, 2, 3}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Collect failed: got %v, want %v", s.Values(), expected)
 	}
 }
 
-func TestValues(t *testing.T) {
+func TestAdd(t *testing.T) {
 	s := orderedset.New[int]()
 	s.Add(1)
 	s.Add(2)
+	s.Add(2)
+
 	expected := []int{1, 2}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Add failed: got %v, want %v", s.Values(), expected)
+	}
+}
 
-	if vals := s.Values(); !reflect.DeepEqual(vals, expected) {
-		t.Errorf("Values failed: got %v, want %v", vals, expected)
+func TestAddAllFunc(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(1))
+
+	var duplicates []int
+	s.AddAllFunc([]int{1, 2, 3, 2, 4, 3}, func(v int) {
+		duplicates = append(duplicates, v)
+		if !s.Has(v) {
+			t.Errorf("AddAllFunc failed: duplicate %v not in set", v)
+		}
+	})
+
+	expected := []int{1, 2, 3, 4}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("AddAllFunc failed: got %v, want %v", s.Values(), expected)
+	}
+	expectedDuplicates := []int{1, 2, 3}
+	if !reflect.DeepEqual(duplicates, expectedDuplicates) {
+		t.Errorf("AddAllFunc failed: got duplicates %v, want %v", duplicates, expectedDuplicates)
 	}
 }
 
-func TestClone(t *testing.T) {
+func TestAddIf(t *testing.T) {
 	s := orderedset.New[int]()
 	s.Add(1)
-	s.Add(2)
 
-	clone := s.Clone()
-	if !reflect.DeepEqual(s.Values(), clone.Values()) {
-		t.Error("Clone failed: cloned values differ")
+	if !s.AddIf(2, func(v *orderedset.OrderedSet[int]) bool { return v.Has(1) }) {
+		t.Error("AddIf failed: expected true when condition holds")
+	}
+	if s.AddIf(3, func(v *orderedset.OrderedSet[int]) bool { return v.Len() > 5 }) {
+		t.Error("AddIf failed: expected false when condition fails")
+	}
+	if s.AddIf(2, func(*orderedset.OrderedSet[int]) bool { return true }) {
+		t.Error("AddIf failed: expected false for existing value")
 	}
 
-	clone.Add(3)
-	if s.Has(3) {
-		t.Error("Clone failed: original modified after clone changed")
+	expected := []int{1, 2}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("AddIf failed: got %v, want %v", s.Values(), expected)
 	}
 }
 
-func TestUnion(t *testing.T) {
-	s1 := orderedset.New[int]()
-	s2 := orderedset.New[int]()
+func TestCompact(t *testing.T) {
+	s := orderedset.New[int]()
+	for i := range 100 {
+		s.Add(i)
+	}
+	for i := range 90 {
+		s.Remove(i)
+	}
 
-	s1.Add(1)
-	s1.Add(2)
+	s.Compact()
+	if c := s.Cap(); c != 10 {
+		t.Errorf("Compact failed: got capacity %d, want 10", c)
+	}
 
-	s2.Add(2)
-	s2.Add(3)
+	expected := []int{90, 91, 92, 93, 94, 95, 96, 97, 98, 99}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Compact failed: got %v, want %v", s.Values(), expected)
+	}
+	if !s.Has(95) || s.Has(5) {
+		t.Error("Compact failed: membership changed")
+	}
+}
 
-	union := s1.Union(s2)
-	expected := []int{1, 2, 3}
+func TestInsertSetAt(t *testing.T) {
+	for n, tc := range map[string]struct {
+		index   int
+		want    []int
+		wantErr error
+	}{
+		"insert at front":     {index: 0, want: []int{5, 1, 2, 3, 4}},
+		"insert at middle":    {index: 2, want: []int{1, 2, 5, 3, 4}},
+		"insert at end":       {index: 4, want: []int{1, 2, 3, 4, 5}},
+		"invalid index < 0":   {index: -1, wantErr: orderedset.ErrIndexOutOfRange},
+		"invalid index > len": {index: 5, wantErr: orderedset.ErrIndexOutOfRange},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New[int]()
+			for _, v := range []int{1, 2, 3, 4} {
+				s.Add(v)
+			}
+			other := orderedset.New[int]()
+			other.Add(5)
+			other.Add(3)
 
-	if !reflect.DeepEqual(union.Values(), expected) {
-		t.Errorf("Union failed: got %v, want %v", union.Values(), expected)
+			err := s.InsertSetAt(tc.index, other)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("InsertSetAt(%d) error = %v, wantErr %v", tc.index, err, tc.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(s.Values(), tc.want) {
+				t.Errorf("InsertSetAt(%d) = %v, want %v", tc.index, s.Values(), tc.want)
+			}
+		})
 	}
 }
 
-func TestIntersect(t *testing.T) {
-	s1 := orderedset.New[int]()
-	s2 := orderedset.New[int]()
-
-	s1.Add(1)
-	s1.Add(2)
+func TestNewFromMatches(t *testing.T) {
+	s := orderedset.NewFromMatches(regexp.MustCompile(`#\w+`), "#go is fun, #rust too, #go again and #zig, #rust")
 
-	s2.Add(2)
-	s2.Add(3)
+	expected := []string{"#go", "#rust", "#zig"}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("NewFromMatches failed: got %v, want %v", s.Values(), expected)
+	}
+	if none := orderedset.NewFromMatches(regexp.MustCompile(`\d+`), "no digits"); none.Len() != 0 {
+		t.Errorf("NewFromMatches failed: got %v, want []", none.Values())
+	}
+}
 
-	intersect := s1.Intersect(s2)
-	expected := []int{2}
+func TestGetOrAdd(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(1))
 
-	if !reflect.DeepEqual(intersect.Values(), expected) {
-		t.Errorf("Intersect failed: got %v, want %v", intersect.Values(), expected)
+	if stored, loaded := s.GetOrAdd(1); !loaded || stored != 1 {
+		t.Errorf("GetOrAdd failed: got (%v, %v), want (1, true)", stored, loaded)
+	}
+	if stored, loaded := s.GetOrAdd(2); loaded || stored != 2 {
+		t.Errorf("GetOrAdd failed: got (%v, %v), want (2, false)", stored, loaded)
+	}
+	if expected := []int{1, 2}; !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("GetOrAdd failed: got %v, want %v", s.Values(), expected)
 	}
 }
 
-func TestDifference(t *testing.T) {
-	s1 := orderedset.New[int]()
-	s2 := orderedset.New[int]()
-
-	s1.Add(1)
-	s1.Add(2)
+func TestAddOrdered(t *testing.T) {
+	s := orderedset.New[string]()
 
-	s2.Add(2)
-	s2.Add(3)
+	var wg sync.WaitGroup
+	for seq := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Duration(50-seq) * 10 * time.Microsecond)
+			s.AddOrdered(uint64(seq), strconv.Itoa(seq))
+		}()
+	}
+	wg.Wait()
 
-	diff := s1.Difference(s2)
-	expected := []int{1}
+	expected := make([]string, 50)
+	for i := range expected {
+		expected[i] = strconv.Itoa(i)
+	}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("AddOrdered failed: got %v, want %v", s.Values(), expected)
+	}
 
-	if !reflect.DeepEqual(diff.Values(), expected) {
-		t.Errorf("Difference failed: got %v, want %v", diff.Values(), expected)
+	s.AddOrdered(3, "late")
+	if s.Has("late") {
+		t.Error("AddOrdered failed: expected a reused sequence number to be ignored")
 	}
 }
 
-func TestSlice(t *testing.T) {
-	s := orderedset.New[int]()
-	for i := 1; i <= 5; i++ {
-		s.Add(i)
+func TestHasEach(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial("go", "rust"))
+
+	got := s.HasEach([]string{"rust", "zig", "go", "go"})
+	expected := []bool{true, false, true, true}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("HasEach failed: got %v, want %v", got, expected)
 	}
+}
 
-	for n, tc := range map[string]struct {
-		from    int
-		to      int
-		want    []int
-		wantErr bool
-	}{
-		"valid slice 0-3":   {from: 0, to: 3, want: []int{1, 2, 3}},
-		"valid slice 1-5":   {from: 1, to: 5, want: []int{2, 3, 4, 5}},
-		"valid empty 3-3":   {from: 3, to: 3, want: []int{}},
-		"invalid from < 0":  {from: -1, to: 3, wantErr: true},
-		"invalid to > len":  {from: 2, to: 6, wantErr: true},
-		"invalid from > to": {from: 4, to: 2, wantErr: true},
-	} {
-		t.Run(n, func(t *testing.T) {
-			got, err := s.Slice(tc.from, tc.to)
-			if (err != nil) != tc.wantErr {
-				t.Errorf("Slice(%d, %d) error = %v, wantErr %v", tc.from, tc.to, err, tc.wantErr)
-				return
-			}
-			if err == nil && !reflect.DeepEqual(got.Values(), tc.want) {
-				t.Errorf("Slice(%d, %d) = %v, want %v", tc.from, tc.to, got.Values(), tc.want)
-			}
-		})
+func TestPresentIn(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial("go", "rust", "zig"))
+
+	got := s.PresentIn([]string{"zig", "c", "go", "zig"})
+	expected := []string{"zig", "go", "zig"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("PresentIn failed: got %v, want %v", got, expected)
+	}
+	if got := s.PresentIn([]string{"c"}); len(got) != 0 {
+		t.Errorf("PresentIn failed: got %v, want []", got)
 	}
 }
 
-func TestSortBy(t *testing.T) {
+func TestNormalize(t *testing.T) {
 	s := orderedset.New[int]()
-	s.Add(3)
 	s.Add(1)
 	s.Add(2)
+	s.Add(3)
+	orderedset.InjectDuplicate(s, 2)
+	orderedset.InjectDuplicate(s, 1)
 
-	s.SortBy(func(a, b int) bool { return a < b })
-	expectedAsc := []int{1, 2, 3}
-	if !reflect.DeepEqual(s.Values(), expectedAsc) {
-		t.Errorf("SortBy ascending failed: got %v, want %v", s.Values(), expectedAsc)
+	if removed := s.Normalize(); removed != 2 {
+		t.Errorf("Normalize failed: got %d removed, want 2", removed)
 	}
-
-	s.SortBy(func(a, b int) bool { return a > b })
-	expectedDesc := []int{3, 2, 1}
-	if !reflect.DeepEqual(s.Values(), expectedDesc) {
-		t.Errorf("SortBy descending failed: got %v, want %v", s.Values(), expectedDesc)
+	expected := []int{1, 2, 3}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Normalize failed: got %v, want %v", s.Values(), expected)
+	}
+	if idx := s.IndexOf(3); idx != 2 {
+		t.Errorf("Normalize failed: IndexOf(3) got %d, want 2", idx)
+	}
+	if removed := s.Normalize(); removed != 0 {
+		t.Errorf("Normalize failed: got %d removed from a clean set, want 0", removed)
 	}
 }
 
-func TestMarshalJSON(t *testing.T) {
+func TestHas(t *testing.T) {
 	s := orderedset.New[int]()
 	s.Add(1)
-	s.Add(2)
 
-	b, err := json.Marshal(s)
-	if err != nil {
-		t.Fatalf("Marshal failed: %v", err)
+	if !s.Has(1) {
+		t.Error("Has failed: expected true for 1")
 	}
-
-	wantJSON := `[1,2]`
-	if string(b) != wantJSON {
-		t.Errorf("Marshal JSON failed: got %s, want %s", string(b), wantJSON)
+	if s.Has(2) {
+		t.Error("Has failed: expected false for 2")
 	}
 }
 
-func TestUnmarshalJSON(t *testing.T) {
-	input := `[1,2]`
-	s := orderedset.New[int]()
-	err := json.Unmarshal([]byte(input), s)
-	if err != nil {
-		t.Fatalf("Unmarshal failed: %v", err)
+func TestHasFunc(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial("Alice", "Bob"))
+
+	if !s.HasFunc(func(v string) bool { return strings.EqualFold(v, "bob") }) {
+		t.Error("HasFunc failed: expected a case-insensitive match for bob")
+	}
+	if s.HasFunc(func(v string) bool { return strings.EqualFold(v, "carol") }) {
+		t.Error("HasFunc failed: expected no match for carol")
 	}
+}
 
-	expected := []int{1, 2}
+func TestReplaceContents(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(1, 2, 3))
+	s.ReplaceContents([]int{4, 5, 4, 6})
+
+	expected := []int{4, 5, 6}
 	if !reflect.DeepEqual(s.Values(), expected) {
-		t.Errorf("Unmarshal JSON failed: got %v, want %v", s.Values(), expected)
+		t.Errorf("ReplaceContents failed: got %v, want %v", s.Values(), expected)
+	}
+	if s.Has(1) || s.IndexOf(6) != 2 {
+		t.Error("ReplaceContents failed: index not rebuilt")
+	}
+}
+
+func TestReplaceContentsConcurrent(t *testing.T) {
+	even := []int{0, 2, 4, 6, 8}
+	odd := []int{1, 3, 5, 7, 9, 11, 13}
+	s := orderedset.New(orderedset.WithInitial(even...))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			if i%2 == 0 {
+				s.ReplaceContents(odd)
+			} else {
+				s.ReplaceContents(even)
+			}
+		}
+	}()
+
+	for range 1000 {
+		values := s.Values()
+		if !reflect.DeepEqual(values, even) && !reflect.DeepEqual(values, odd) {
+			t.Fatalf("ReplaceContents failed: observed partial contents %v", values)
+		}
+	}
+	wg.Wait()
+}
+
+func TestRemove(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+
+	s.Remove(1)
+	if s.Has(1) {
+		t.Error("Remove failed: 1 should be removed")
+	}
+
+	s.Remove(3)
+	if s.Len() != 1 {
+		t.Error("Remove failed: length should remain 1 after removing non-existing")
+	}
+}
+
+func TestTake(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+
+	if !s.Take(1) {
+		t.Error("Take failed: expected true for present value")
+	}
+	if s.Has(1) {
+		t.Error("Take failed: 1 should be removed")
+	}
+	if s.Take(1) {
+		t.Error("Take failed: expected false for already removed value")
+	}
+	if s.Len() != 1 {
+		t.Errorf("Take failed: got length %d, want 1", s.Len())
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+	s.Add(3)
+
+	if !s.Update(2, 20) {
+		t.Error("Update failed: expected true for present old and absent new")
+	}
+	expected := []int{1, 20, 3}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Update failed: got %v, want %v", s.Values(), expected)
+	}
+	if s.Has(2) || !s.Has(20) {
+		t.Error("Update failed: index not updated")
+	}
+
+	if s.Update(5, 50) {
+		t.Error("Update failed: expected false for missing old")
+	}
+	if s.Update(1, 3) {
+		t.Error("Update failed: expected false for colliding new")
+	}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Update failed: set modified, got %v, want %v", s.Values(), expected)
+	}
+}
+
+func TestCompareAndReplace(t *testing.T) {
+	for range 100 {
+		s := orderedset.New(orderedset.WithInitial(1, 2, 3))
+
+		var wg sync.WaitGroup
+		results := make([]bool, 2)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i] = s.CompareAndReplace(2, 10*(i+1))
+			}()
+		}
+		wg.Wait()
+
+		if results[0] == results[1] {
+			t.Fatalf("CompareAndReplace failed: got results %v, want exactly one success", results)
+		}
+		winner := 10
+		if results[1] {
+			winner = 20
+		}
+		if expected := []int{1, winner, 3}; !reflect.DeepEqual(s.Values(), expected) {
+			t.Fatalf("CompareAndReplace failed: got %v, want %v", s.Values(), expected)
+		}
+	}
+
+	s := orderedset.New(orderedset.WithInitial(1, 2))
+	if s.CompareAndReplace(1, 2) || s.CompareAndReplace(5, 6) {
+		t.Error("CompareAndReplace failed: expected false when replacement exists or old is missing")
+	}
+}
+
+func TestShift(t *testing.T) {
+	for n, tc := range map[string]struct {
+		value int
+		delta int
+		want  []int
+	}{
+		"towards end":     {value: 2, delta: 2, want: []int{1, 3, 4, 2, 5}},
+		"towards front":   {value: 4, delta: -2, want: []int{1, 4, 2, 3, 5}},
+		"past the start":  {value: 3, delta: -10, want: []int{3, 1, 2, 4, 5}},
+		"past the end":    {value: 3, delta: 10, want: []int{1, 2, 4, 5, 3}},
+		"zero delta":      {value: 3, delta: 0, want: []int{1, 2, 3, 4, 5}},
+		"already at last": {value: 5, delta: 1, want: []int{1, 2, 3, 4, 5}},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New(orderedset.WithInitial(1, 2, 3, 4, 5))
+			if !s.Shift(tc.value, tc.delta) {
+				t.Fatalf("Shift(%d, %d) failed: got false, want true", tc.value, tc.delta)
+			}
+			if !reflect.DeepEqual(s.Values(), tc.want) {
+				t.Errorf("Shift(%d, %d) = %v, want %v", tc.value, tc.delta, s.Values(), tc.want)
+			}
+			for i, v := range tc.want {
+				if idx := s.IndexOf(v); idx != i {
+					t.Errorf("Shift(%d, %d) failed: IndexOf(%d) got %d, want %d", tc.value, tc.delta, v, idx, i)
+				}
+			}
+		})
+	}
+
+	s := orderedset.New(orderedset.WithInitial(1, 2))
+	if s.Shift(3, 1) {
+		t.Error("Shift failed: expected false for a missing value")
+	}
+}
+
+func TestRemoveAt(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(10)
+	s.Add(20)
+
+	val, ok := s.RemoveAt(1)
+	if !ok || val != 20 {
+		t.Errorf("RemoveAt failed: got (%v, %v), want (20, true)", val, ok)
+	}
+
+	val, ok = s.RemoveAt(5)
+	if ok {
+		t.Error("RemoveAt failed: expected false for invalid index")
+	}
+}
+
+func TestRemoveRange(t *testing.T) {
+	for n, tc := range map[string]struct {
+		from        int
+		to          int
+		wantRemoved []int
+		wantValues  []int
+		wantErr     error
+	}{
+		"valid range 1-3":   {from: 1, to: 3, wantRemoved: []int{2, 3}, wantValues: []int{1, 4, 5}},
+		"valid range 0-5":   {from: 0, to: 5, wantRemoved: []int{1, 2, 3, 4, 5}, wantValues: []int{}},
+		"valid empty 2-2":   {from: 2, to: 2, wantRemoved: []int{}, wantValues: []int{1, 2, 3, 4, 5}},
+		"invalid from < 0":  {from: -1, to: 3, wantErr: orderedset.ErrIndexOutOfRange},
+		"invalid to > len":  {from: 2, to: 6, wantErr: orderedset.ErrIndexOutOfRange},
+		"invalid from > to": {from: 4, to: 2, wantErr: orderedset.ErrInvalidRange},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New(orderedset.WithInitial(1, 2, 3, 4, 5))
+			removed, err := s.RemoveRange(tc.from, tc.to)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("RemoveRange(%d, %d) error = %v, wantErr %v", tc.from, tc.to, err, tc.wantErr)
+				return
+			}
+			if err != nil {
+				if s.Len() != 5 {
+					t.Errorf("RemoveRange(%d, %d) modified the set on error: %v", tc.from, tc.to, s.Values())
+				}
+				return
+			}
+			if !reflect.DeepEqual(removed, tc.wantRemoved) || !reflect.DeepEqual(s.Values(), tc.wantValues) {
+				t.Errorf("RemoveRange(%d, %d) = %v leaving %v, want %v leaving %v",
+					tc.from, tc.to, removed, s.Values(), tc.wantRemoved, tc.wantValues)
+			}
+			for i, v := range s.Values() {
+				if idx := s.IndexOf(v); idx != i {
+					t.Errorf("RemoveRange(%d, %d) failed: IndexOf(%d) got %d, want %d", tc.from, tc.to, v, idx, i)
+				}
+			}
+			for _, v := range removed {
+				if s.Has(v) {
+					t.Errorf("RemoveRange(%d, %d) failed: %d still present", tc.from, tc.to, v)
+				}
+			}
+		})
+	}
+}
+
+func TestPopN(t *testing.T) {
+	for name, tc := range map[string]struct {
+		n          int
+		wantPopped []int
+		wantValues []int
+	}{
+		"normal":      {n: 2, wantPopped: []int{1, 2}, wantValues: []int{3, 4}},
+		"more than n": {n: 10, wantPopped: []int{1, 2, 3, 4}, wantValues: []int{}},
+		"zero":        {n: 0, wantPopped: []int{}, wantValues: []int{1, 2, 3, 4}},
+		"negative":    {n: -1, wantPopped: []int{}, wantValues: []int{1, 2, 3, 4}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := orderedset.New(orderedset.WithInitial(1, 2, 3, 4))
+			popped := s.PopN(tc.n)
+			if !reflect.DeepEqual(popped, tc.wantPopped) || !reflect.DeepEqual(s.Values(), tc.wantValues) {
+				t.Errorf("PopN(%d) = %v leaving %v, want %v leaving %v", tc.n, popped, s.Values(), tc.wantPopped, tc.wantValues)
+			}
+			if len(tc.wantValues) > 0 && s.IndexOf(tc.wantValues[0]) != 0 {
+				t.Errorf("PopN(%d) failed: index not updated", tc.n)
+			}
+		})
+	}
+}
+
+func TestRemoveIter(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial("a", "b", "c", "d", "e"))
+
+	var visited []string
+	var i int
+	removed := s.RemoveIter(func(v string) bool {
+		visited = append(visited, v)
+		i++
+		return i%2 == 0
+	})
+
+	if removed != 2 {
+		t.Errorf("RemoveIter failed: got %d removed, want 2", removed)
+	}
+	if expected := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(visited, expected) {
+		t.Errorf("RemoveIter failed: visited %v, want %v", visited, expected)
+	}
+	if expected := []string{"a", "c", "e"}; !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("RemoveIter failed: got %v, want %v", s.Values(), expected)
+	}
+	if s.Has("b") || s.IndexOf("e") != 2 {
+		t.Error("RemoveIter failed: index not updated")
+	}
+}
+
+func TestAppendTo(t *testing.T) {
+	s1 := orderedset.New[int]()
+	s1.Add(1)
+	s1.Add(2)
+
+	s2 := orderedset.New[int]()
+	s2.Add(2)
+	s2.Add(3)
+
+	buf := make([]int, 0, 4)
+	buf = s1.AppendTo(buf)
+	buf = s2.AppendTo(buf)
+
+	expected := []int{1, 2, 2, 3}
+	if !reflect.DeepEqual(buf, expected) {
+		t.Errorf("AppendTo failed: got %v, want %v", buf, expected)
+	}
+}
+
+func TestIndices(t *testing.T) {
+	s := orderedset.New[string]()
+	s.Add("a")
+	s.Add("b")
+	s.Add("c")
+
+	expected := []int{0, 1, 2}
+	if got := s.Indices(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Indices failed: got %v, want %v", got, expected)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial("a", "b", "c"))
+
+	entries := s.Entries()
+	if len(entries) != s.Len() {
+		t.Fatalf("Entries failed: got %d entries, want %d", len(entries), s.Len())
+	}
+	for i, e := range entries {
+		if want, _ := s.At(i); e.Index != i || e.Value != want {
+			t.Errorf("Entries failed: got %+v at position %d, want {Index:%d Value:%v}", e, i, i, want)
+		}
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	s := orderedset.New[string]()
+	s.Add("a")
+	s.Add("b")
+	s.Add("c")
+
+	var count int
+	for i, v := range s.Enumerate() {
+		if want, _ := s.At(i); v != want {
+			t.Errorf("Enumerate failed: got %v at index %d, want %v", v, i, want)
+		}
+		count++
+	}
+	if count != s.Len() {
+		t.Errorf("Enumerate failed: got %d pairs, want %d", count, s.Len())
+	}
+}
+
+func TestBackward(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial("a", "b", "c"))
+
+	var forward, backward []string
+	var indices []int
+	for _, v := range s.Enumerate() {
+		forward = append(forward, v)
+	}
+	for i, v := range s.Backward() {
+		indices = append(indices, i)
+		backward = append(backward, v)
+	}
+
+	slices.Reverse(backward)
+	if !reflect.DeepEqual(backward, forward) {
+		t.Errorf("Backward failed: got %v reversed, want %v", backward, forward)
+	}
+	if expected := []int{2, 1, 0}; !reflect.DeepEqual(indices, expected) {
+		t.Errorf("Backward failed: got indices %v, want %v", indices, expected)
+	}
+
+	for i := range s.Backward() {
+		if i != 2 {
+			t.Errorf("Backward failed: got index %d first, want 2", i)
+		}
+		break
+	}
+}
+
+func TestLenAndValues(t *testing.T) {
+	s := orderedset.New[int]()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			s.Add(i)
+		}
+	}()
+
+	for range 1000 {
+		n, values := s.LenAndValues()
+		if n != len(values) {
+			t.Fatalf("LenAndValues failed: got length %d for %d values", n, len(values))
+		}
+	}
+	wg.Wait()
+}
+
+func TestForEachLive(t *testing.T) {
+	s := orderedset.New[int]()
+	for i := range 5 {
+		s.Add(i)
+	}
+
+	var got []int
+	s.ForEachLive(func(i int, v int) bool {
+		got = append(got, v)
+		return i < 2
+	})
+	expected := []int{0, 1, 2}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ForEachLive failed: got %v, want %v", got, expected)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 5; i < 500; i++ {
+			s.Add(i)
+			s.Remove(i - 5)
+		}
+	}()
+
+	var visited int
+	s.ForEachLive(func(int, int) bool {
+		visited++
+		return true
+	})
+	wg.Wait()
+	if visited == 0 {
+		t.Error("ForEachLive failed: expected at least one element to be visited")
+	}
+}
+
+func TestValuesFunc(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+
+	var sum int
+	s.ValuesFunc(func(values []int) {
+		for _, v := range values {
+			sum += v
+		}
+	})
+	if sum != 3 {
+		t.Errorf("ValuesFunc failed: got sum %d, want 3", sum)
+	}
+}
+
+func BenchmarkValues(b *testing.B) {
+	s := orderedset.New[int]()
+	for i := range 1000 {
+		s.Add(i)
+	}
+
+	b.Run("Values", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var sum int
+			for _, v := range s.Values() {
+				sum += v
+			}
+		}
+	})
+
+	b.Run("ValuesFunc", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var sum int
+			s.ValuesFunc(func(values []int) {
+				for _, v := range values {
+					sum += v
+				}
+			})
+		}
+	})
+}
+
+func TestStream(t *testing.T) {
+	s := orderedset.New[int]()
+	for i := 1; i <= 5; i++ {
+		s.Add(i)
+	}
+
+	var got []int
+	for v := range s.Stream(context.Background()) {
+		got = append(got, v)
+	}
+	expected := []int{1, 2, 3, 4, 5}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Stream failed: got %v, want %v", got, expected)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := s.Stream(ctx)
+	if v := <-ch; v != 1 {
+		t.Errorf("Stream failed: got %v, want 1", v)
+	}
+	cancel()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Stream failed: channel not closed after cancellation")
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(5)
+
+	val, ok := s.At(0)
+	if !ok || val != 5 {
+		t.Errorf("At failed: got (%v, %v), want (5, true)", val, ok)
+	}
+
+	_, ok = s.At(1)
+	if ok {
+		t.Error("At failed: expected false for out of range index")
+	}
+}
+
+func TestFirstLast(t *testing.T) {
+	s := orderedset.New[int]()
+	if _, ok := s.First(); ok {
+		t.Error("First failed: expected false for empty set")
+	}
+	if _, ok := s.Newest(); ok {
+		t.Error("Newest failed: expected false for empty set")
+	}
+
+	s.Add(1)
+	s.Add(2)
+	s.Add(3)
+
+	if val, ok := s.First(); !ok || val != 1 {
+		t.Errorf("First failed: got (%v, %v), want (1, true)", val, ok)
+	}
+	if val, ok := s.Oldest(); !ok || val != 1 {
+		t.Errorf("Oldest failed: got (%v, %v), want (1, true)", val, ok)
+	}
+	if val, ok := s.Last(); !ok || val != 3 {
+		t.Errorf("Last failed: got (%v, %v), want (3, true)", val, ok)
+	}
+	if val, ok := s.Newest(); !ok || val != 3 {
+		t.Errorf("Newest failed: got (%v, %v), want (3, true)", val, ok)
+	}
+}
+
+func TestPeekBack(t *testing.T) {
+	s := orderedset.New[int]()
+	if _, ok := s.PeekBack(0); ok {
+		t.Error("PeekBack failed: expected false for empty set")
+	}
+
+	s.Add(1)
+	s.Add(2)
+	s.Add(3)
+
+	if val, ok := s.PeekBack(0); !ok || val != 3 {
+		t.Errorf("PeekBack failed: got (%v, %v), want (3, true)", val, ok)
+	}
+	if val, ok := s.PeekBack(2); !ok || val != 1 {
+		t.Errorf("PeekBack failed: got (%v, %v), want (1, true)", val, ok)
+	}
+	if _, ok := s.PeekBack(3); ok {
+		t.Error("PeekBack failed: expected false for out of range n")
+	}
+	if s.Len() != 3 {
+		t.Errorf("PeekBack failed: got length %d, want 3", s.Len())
+	}
+}
+
+func TestIndexOf(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(5)
+	s.Add(10)
+
+	if idx := s.IndexOf(10); idx != 1 {
+		t.Errorf("IndexOf failed: got %d, want 1", idx)
+	}
+
+	if idx := s.IndexOf(15); idx != -1 {
+		t.Errorf("IndexOf failed: got %d, want -1", idx)
+	}
+}
+
+func TestIndexOfAfterMutations(t *testing.T) {
+	s := orderedset.New[int]()
+	for i := range 10 {
+		s.Add(i)
+	}
+	s.Remove(0)
+	s.RemoveAt(3)
+	s.Update(5, 50)
+	other := orderedset.New[int]()
+	other.Add(100)
+	other.Add(101)
+	if err := s.InsertSetAt(2, other); err != nil {
+		t.Fatalf("InsertSetAt failed: %v", err)
+	}
+
+	assertPositions := func(step string) {
+		for i, v := range s.Values() {
+			if idx := s.IndexOf(v); idx != i {
+				t.Errorf("IndexOf after %s failed: got %d for %v, want %d", step, idx, v, i)
+			}
+		}
+	}
+	assertPositions("mutations")
+
+	s.SortBy(func(a, b int) bool { return a > b })
+	assertPositions("SortBy")
+}
+
+func TestIndexOfAfterInterleavedRemovals(t *testing.T) {
+	s := orderedset.New[int](orderedset.WithCopyOnWrite[int]())
+	for i := range 200 {
+		s.Add(i)
+	}
+
+	assertPositions := func(step int) {
+		t.Helper()
+		for i, v := range s.Values() {
+			if idx := s.IndexOf(v); idx != i {
+				t.Fatalf("IndexOf after step %d failed: got %d for %v, want %d", step, idx, v, i)
+			}
+		}
+	}
+	for step := range 600 {
+		switch step % 6 {
+		case 0:
+			s.RemoveAt(0)
+		case 1:
+			s.RemoveAt(step % s.Len())
+		case 2:
+			s.Add(1000 + step)
+		case 3:
+			s.PopN(2)
+			s.Add(2000 + step)
+		case 4:
+			if _, err := s.RemoveRange(s.Len()/3, s.Len()/3+2); err != nil {
+				t.Fatalf("RemoveRange failed: %v", err)
+			}
+			s.Update(s.Values()[s.Len()/2], 3000+step)
+		case 5:
+			s.Shift(s.Values()[1], 3)
+			s = s.Clone()
+		}
+		for i := range 3 {
+			s.Add(4000 + 3*step + i)
+		}
+		assertPositions(step)
+	}
+}
+
+func TestIndexOfInBoundedSet(t *testing.T) {
+	s := orderedset.New[int](orderedset.WithBounded[int](50))
+	for i := range 500 {
+		s.Add(i)
+		first, _ := s.First()
+		if idx := s.IndexOf(i); idx != s.Len()-1 {
+			t.Fatalf("IndexOf(%d) failed: got %d, want %d", i, idx, s.Len()-1)
+		}
+		if idx := s.IndexOf(first); idx != 0 {
+			t.Fatalf("IndexOf(%d) failed: got %d, want 0", first, idx)
+		}
+	}
+}
+
+// BenchmarkInterleaved measures interleaved Add, IndexOf and Remove on sets of 64K and 1M
+// elements. Removals only record gaps in the index, so "back" and "front" must cost the same at
+// both sizes, and "random" may only grow by the values it shifts, never by reindexing them.
+func BenchmarkInterleaved(b *testing.B) {
+	for _, n := range []int{1 << 16, 1 << 20} {
+		for _, victim := range []struct {
+			name string
+			pick func(i, added int) int
+		}{
+			{"back", func(i, added int) int { return added }},
+			{"front", func(i, added int) int { return i }},
+			{"random", func(i, added int) int { return int(uint64(i) * 0x9e3779b97f4a7c15 % uint64(n+i)) }},
+		} {
+			b.Run(fmt.Sprintf("%s/n=%d", victim.name, n), func(b *testing.B) {
+				s := orderedset.New[int]()
+				for i := range n {
+					s.Add(i)
+				}
+				b.ResetTimer()
+				for i := range b.N {
+					v := n + i
+					s.Add(v)
+					s.IndexOf(i % n)
+					s.IndexOf(v)
+					s.Remove(victim.pick(i, v))
+				}
+			})
+		}
+	}
+}
+
+func TestLastIndexOf(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(5)
+	s.Add(10)
+
+	if idx := s.LastIndexOf(10); idx != 1 {
+		t.Errorf("LastIndexOf failed: got %d, want 1", idx)
+	}
+
+	if idx := s.LastIndexOf(15); idx != -1 {
+		t.Errorf("LastIndexOf failed: got %d, want -1", idx)
+	}
+}
+
+func TestIndexOfFunc(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(5)
+	s.Add(10)
+	s.Add(20)
+
+	if idx := s.IndexOfFunc(func(v int) bool { return v > 7 }); idx != 1 {
+		t.Errorf("IndexOfFunc failed: got %d, want 1", idx)
+	}
+
+	if idx := s.IndexOfFunc(func(v int) bool { return v > 100 }); idx != -1 {
+		t.Errorf("IndexOfFunc failed: got %d, want -1", idx)
+	}
+}
+
+func TestNewInstrumented(t *testing.T) {
+	s := orderedset.NewInstrumented[int]()
+	s.Add(1)
+	s.Has(1)
+	s.Values()
+
+	stats := s.Stats()
+	if stats.Acquisitions != 3 || stats.Contended != 0 {
+		t.Errorf("Stats failed: got %+v, want 3 uncontended acquisitions", stats)
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				s.Add(i)
+				s.Remove(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats = s.Stats()
+	if stats.Acquisitions != 1603 {
+		t.Errorf("Stats failed: got %d acquisitions, want 1603", stats.Acquisitions)
+	}
+	if stats.HoldTime <= 0 {
+		t.Errorf("Stats failed: got hold time %v, want it positive", stats.HoldTime)
+	}
+
+	held, release := make(chan struct{}), make(chan struct{})
+	go s.ValuesFunc(func([]int) {
+		close(held)
+		<-release
+	})
+	<-held
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	s.Add(1)
+	if c := s.Stats().Contended; c < 1 {
+		t.Errorf("Stats failed: got %d contended acquisitions, want at least 1", c)
+	}
+
+	if plain := orderedset.New[int]().Stats(); plain != (orderedset.LockStats{}) {
+		t.Errorf("Stats failed: got %+v for a set that is not instrumented", plain)
+	}
+}
+
+func TestContextAware(t *testing.T) {
+	s := orderedset.NewContextAware[int]()
+	s.Add(1)
+
+	ok, err := s.HasContext(context.Background(), 1)
+	if err != nil || !ok {
+		t.Errorf("HasContext failed: got (%v, %v), want (true, nil)", ok, err)
+	}
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Transaction(func(tx *orderedset.OrderedSet[int]) error {
+			close(locked)
+			<-release
+			tx.Add(2)
+			return nil
+		})
+	}()
+	<-locked
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.HasContext(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("HasContext failed: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := s.ValuesContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ValuesContext failed: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	<-done
+	values, err := s.ValuesContext(context.Background())
+	if err != nil || !reflect.DeepEqual(values, []int{1, 2}) {
+		t.Errorf("ValuesContext failed: got (%v, %v), want ([1 2], nil)", values, err)
+	}
+}
+
+func TestContextAwareConcurrent(t *testing.T) {
+	s := orderedset.NewContextAware[int]()
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				s.Add(i*100 + j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				if _, err := s.HasContext(context.Background(), j); err != nil {
+					t.Errorf("HasContext failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if l := s.Len(); l != 1000 {
+		t.Errorf("Len failed: got %d, want 1000", l)
+	}
+}
+
+func TestLen(t *testing.T) {
+	s := orderedset.New[int]()
+	if l := s.Len(); l != 0 {
+		t.Errorf("Len failed: got %d, want 0", l)
+	}
+
+	s.Add(1)
+	if l := s.Len(); l != 1 {
+		t.Errorf("Len failed: got %d, want 1", l)
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	s := orderedset.New[int]()
+	if !s.IsEmpty() || s.NonEmpty() {
+		t.Error("IsEmpty failed: expected a new set to be empty")
+	}
+
+	s.Add(1)
+	if s.IsEmpty() || !s.NonEmpty() {
+		t.Error("IsEmpty failed: expected a set with one element to be non-empty")
+	}
+
+	s.Remove(1)
+	if !s.IsEmpty() || s.NonEmpty() {
+		t.Error("IsEmpty failed: expected the set to be empty after removal")
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := orderedset.New(orderedset.WithInitial("a", "b", "c"))
+	b := orderedset.New(orderedset.WithInitial("a", "b", "c"))
+	if a.Hash() != b.Hash() {
+		t.Errorf("Hash failed: got %d and %d for equal sets", a.Hash(), b.Hash())
+	}
+
+	b.Shift("c", -1)
+	if a.Hash() == b.Hash() {
+		t.Errorf("Hash failed: got %d for both %v and %v", a.Hash(), a.Values(), b.Values())
+	}
+	b.Remove("b")
+	b.Add("b")
+	if a.Hash() == b.Hash() {
+		t.Errorf("Hash failed: got %d for both %v and %v", a.Hash(), a.Values(), b.Values())
+	}
+
+	byLength := func(v string) uint64 { return uint64(len(v)) }
+	c := orderedset.New(orderedset.WithInitial("ab", "c"))
+	d := orderedset.New(orderedset.WithInitial("c", "ab"))
+	if c.HashFunc(byLength) == d.HashFunc(byLength) {
+		t.Error("HashFunc failed: expected reordering to change the hash")
+	}
+	if e := orderedset.New(orderedset.WithInitial("xy", "z")); c.HashFunc(byLength) != e.HashFunc(byLength) {
+		t.Error("HashFunc failed: expected equal element hashes in the same order to hash equal")
+	}
+	if orderedset.New[string]().Hash() != orderedset.New[string]().Hash() {
+		t.Error("Hash failed: expected empty sets to hash equal")
+	}
+}
+
+func TestSizeBytes(t *testing.T) {
+	build := func(n int) *orderedset.OrderedSet[string] {
+		s := orderedset.New[string]()
+		for i := range n {
+			s.Add(fmt.Sprintf("element-%06d", i))
+		}
+		return s
+	}
+	small, large := build(10000), build(20000)
+
+	if ratio := float64(large.SizeBytes()) / float64(small.SizeBytes()); ratio < 1.5 || ratio > 2.5 {
+		t.Errorf("SizeBytes failed: got ratio %.2f for twice the elements, want about 2", ratio)
+	}
+	strlen := func(v string) int { return len(v) }
+	if got, want := small.SizeBytesFunc(strlen)-small.SizeBytes(), 10000*len("element-000000"); got != want {
+		t.Errorf("SizeBytesFunc failed: got %d bytes from the sizer, want %d", got, want)
+	}
+	if empty := orderedset.New[int]().SizeBytes(); empty <= 0 || empty >= small.SizeBytes() {
+		t.Errorf("SizeBytes failed: got %d for an empty set", empty)
+	}
+}
+
+func TestCap(t *testing.T) {
+	s := orderedset.New[int]()
+	if c := s.Cap(); c != 0 {
+		t.Errorf("Cap failed: got %d, want 0", c)
+	}
+
+	for i := range 100 {
+		s.Add(i)
+	}
+	if c := s.Cap(); c < 100 {
+		t.Errorf("Cap failed: got %d, want at least 100", c)
+	}
+
+	for i := range 50 {
+		s.Remove(i)
+	}
+	s.Compact()
+	if c := s.Cap(); c != 50 {
+		t.Errorf("Cap failed: got %d after Compact, want 50", c)
+	}
+}
+
+func TestValues(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+	expected := []int{1, 2}
+
+	if vals := s.Values(); !reflect.DeepEqual(vals, expected) {
+		t.Errorf("Values failed: got %v, want %v", vals, expected)
+	}
+}
+
+func TestClone(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+
+	clone := s.Clone()
+	if !reflect.DeepEqual(s.Values(), clone.Values()) {
+		t.Error("Clone failed: cloned values differ")
+	}
+
+	clone.Add(3)
+	if s.Has(3) {
+		t.Error("Clone failed: original modified after clone changed")
+	}
+}
+
+func TestDeepClone(t *testing.T) {
+	type counter struct{ N int }
+	s := orderedset.New(orderedset.WithInitial(&counter{N: 1}, &counter{N: 2}))
+
+	clone := s.DeepClone(func(c *counter) *counter {
+		copied := *c
+		return &copied
+	})
+	for _, c := range clone.Values() {
+		c.N *= 10
+	}
+
+	for i, c := range s.Values() {
+		if c.N != i+1 {
+			t.Errorf("DeepClone failed: original element %d changed to %d", i, c.N)
+		}
+		if cloned, _ := clone.At(i); cloned == c || cloned.N != 10*(i+1) {
+			t.Errorf("DeepClone failed: got %v at index %d, want an independent copy", cloned, i)
+		}
+	}
+}
+
+func TestCloneStableOrder(t *testing.T) {
+	s := orderedset.New[string]()
+	for i := range 10000 {
+		s.Add(strconv.Itoa((i * 7919) % 10007))
+	}
+
+	for n, opts := range map[string][]orderedset.Option[string]{
+		"Eager":       nil,
+		"CopyOnWrite": {orderedset.WithCopyOnWrite[string](), orderedset.WithInitial(s.Values()...)},
+	} {
+		t.Run(n, func(t *testing.T) {
+			src := s
+			if opts != nil {
+				src = orderedset.New(opts...)
+			}
+			for range 3 {
+				if clone := src.Clone(); !reflect.DeepEqual(clone.Values(), s.Values()) {
+					t.Fatal("Clone failed: clone order differs from the original")
+				}
+			}
+		})
+	}
+}
+
+func TestCloneRepeatedly(t *testing.T) {
+	s := orderedset.New[int]()
+	for i := range 5000 {
+		s.Add((i * 7919) % 10007)
+	}
+	for i := 0; i < s.Len(); i += 7 {
+		s.RemoveAt(i)
+	}
+	expected := s.Values()
+
+	clone := s
+	for range 20 {
+		clone = clone.Clone()
+		if !reflect.DeepEqual(clone.Values(), expected) {
+			t.Fatal("Clone failed: clone order differs from the original")
+		}
+	}
+	for i, v := range expected {
+		if idx := clone.IndexOf(v); idx != i {
+			t.Fatalf("Clone failed: IndexOf(%d) got %d, want %d", v, idx, i)
+		}
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+
+	err := s.Transaction(func(tx *orderedset.OrderedSet[int]) error {
+		tx.Remove(1)
+		tx.Add(3)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	expected := []int{2, 3}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Transaction commit failed: got %v, want %v", s.Values(), expected)
+	}
+
+	errAbort := errors.New("abort")
+	err = s.Transaction(func(tx *orderedset.OrderedSet[int]) error {
+		tx.Add(4)
+		tx.Remove(2)
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("Transaction failed: got error %v, want %v", err, errAbort)
+	}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Transaction rollback failed: got %v, want %v", s.Values(), expected)
+	}
+}
+
+func TestTransactionCopyOnWrite(t *testing.T) {
+	s := orderedset.New(orderedset.WithCopyOnWrite[int](), orderedset.WithInitial(1, 2, 3))
+	var union *orderedset.OrderedSet[int]
+	err := s.Transaction(func(tx *orderedset.OrderedSet[int]) error {
+		union = tx.Union(orderedset.New(orderedset.WithInitial(4)))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if !s.Has(1) || s.IndexOf(2) != 1 {
+		t.Errorf("Transaction failed: lost the index, Has(1) = %v, IndexOf(2) = %d", s.Has(1), s.IndexOf(2))
+	}
+
+	s.Add(2)
+	s.Add(5)
+	expected := []int{1, 2, 3, 5}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Transaction failed: got %v, want %v", s.Values(), expected)
+	}
+	if expected := []int{1, 2, 3, 4}; !reflect.DeepEqual(union.Values(), expected) {
+		t.Errorf("Union failed: got %v, want %v", union.Values(), expected)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	even := []int{0, 2, 4, 6}
+	odd := []int{1, 3, 5}
+	a := orderedset.New(orderedset.WithInitial(even...))
+	b := orderedset.New(orderedset.WithInitial(odd...))
+
+	orderedset.Swap(a, b)
+	if !reflect.DeepEqual(a.Values(), odd) || !reflect.DeepEqual(b.Values(), even) {
+		t.Errorf("Swap failed: got %v and %v, want %v and %v", a.Values(), b.Values(), odd, even)
+	}
+	if a.IndexOf(5) != 2 || b.IndexOf(6) != 3 || a.Has(0) || b.Has(1) {
+		t.Error("Swap failed: indices not swapped with the values")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 1000 {
+			orderedset.Swap(a, b)
+		}
+	}()
+	for _, set := range []*orderedset.OrderedSet[int]{a, b, a} {
+		for range 300 {
+			if values := set.Values(); !reflect.DeepEqual(values, even) && !reflect.DeepEqual(values, odd) {
+				t.Fatalf("Swap failed: observed mixed contents %v", values)
+			}
+		}
+	}
+	wg.Wait()
+}
+
+func TestUnion(t *testing.T) {
+	s1 := orderedset.New[int]()
+	s2 := orderedset.New[int]()
+
+	s1.Add(1)
+	s1.Add(2)
+
+	s2.Add(2)
+	s2.Add(3)
+
+	union := s1.Union(s2)
+	expected := []int{1, 2, 3}
+
+	if !reflect.DeepEqual(union.Values(), expected) {
+		t.Errorf("Union failed: got %v, want %v", union.Values(), expected)
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	s1 := orderedset.New[int]()
+	s2 := orderedset.New[int]()
+
+	s1.Add(1)
+	s1.Add(2)
+
+	s2.Add(2)
+	s2.Add(3)
+
+	intersect := s1.Intersect(s2)
+	expected := []int{2}
+
+	if !reflect.DeepEqual(intersect.Values(), expected) {
+		t.Errorf("Intersect failed: got %v, want %v", intersect.Values(), expected)
+	}
+}
+
+func TestIntersectOrder(t *testing.T) {
+	large := orderedset.New[int]()
+	for i := 1; i <= 10; i++ {
+		large.Add(i)
+	}
+	small := orderedset.New[int]()
+	small.Add(8)
+	small.Add(2)
+	small.Add(42)
+
+	expected := []int{2, 8}
+	if got := large.Intersect(small).Values(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Intersect failed: got %v, want %v", got, expected)
+	}
+
+	expected = []int{8, 2}
+	if got := small.Intersect(large).Values(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Intersect failed: got %v, want %v", got, expected)
+	}
+	if got := large.IntersectBySmaller(small).Values(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("IntersectBySmaller failed: got %v, want %v", got, expected)
+	}
+}
+
+func BenchmarkIntersect(b *testing.B) {
+	large := orderedset.New[int]()
+	for i := range 100000 {
+		large.Add(i)
+	}
+	small := orderedset.New[int]()
+	for i := range 10 {
+		small.Add(i * 1000)
+	}
+
+	b.Run("LargeSmall", func(b *testing.B) {
+		for b.Loop() {
+			large.Intersect(small)
+		}
+	})
+
+	b.Run("SmallLarge", func(b *testing.B) {
+		for b.Loop() {
+			small.Intersect(large)
+		}
+	})
+
+	b.Run("BySmaller", func(b *testing.B) {
+		for b.Loop() {
+			large.IntersectBySmaller(small)
+		}
+	})
+}
+
+func TestDifference(t *testing.T) {
+	s1 := orderedset.New[int]()
+	s2 := orderedset.New[int]()
+
+	s1.Add(1)
+	s1.Add(2)
+
+	s2.Add(2)
+	s2.Add(3)
+
+	diff := s1.Difference(s2)
+	expected := []int{1}
+
+	if !reflect.DeepEqual(diff.Values(), expected) {
+		t.Errorf("Difference failed: got %v, want %v", diff.Values(), expected)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	s := orderedset.New[int]()
+	for i := 1; i <= 5; i++ {
+		s.Add(i)
+	}
+
+	for n, tc := range map[string]struct {
+		from    int
+		to      int
+		want    []int
+		wantErr error
+	}{
+		"valid slice 0-3":   {from: 0, to: 3, want: []int{1, 2, 3}},
+		"valid slice 1-5":   {from: 1, to: 5, want: []int{2, 3, 4, 5}},
+		"valid empty 3-3":   {from: 3, to: 3, want: []int{}},
+		"invalid from < 0":  {from: -1, to: 3, wantErr: orderedset.ErrIndexOutOfRange},
+		"invalid to > len":  {from: 2, to: 6, wantErr: orderedset.ErrIndexOutOfRange},
+		"invalid from > to": {from: 4, to: 2, wantErr: orderedset.ErrInvalidRange},
+	} {
+		t.Run(n, func(t *testing.T) {
+			got, err := s.Slice(tc.from, tc.to)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Slice(%d, %d) error = %v, wantErr %v", tc.from, tc.to, err, tc.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got.Values(), tc.want) {
+				t.Errorf("Slice(%d, %d) = %v, want %v", tc.from, tc.to, got.Values(), tc.want)
+			}
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(1, 2, 3, 4, 5))
+
+	for n, tc := range map[string]struct {
+		offset  int
+		limit   int
+		want    []int
+		wantErr error
+	}{
+		"first page":        {offset: 0, limit: 2, want: []int{1, 2}},
+		"last partial page": {offset: 4, limit: 2, want: []int{5}},
+		"offset at end":     {offset: 5, limit: 2, want: []int{}},
+		"offset beyond end": {offset: 10, limit: 2, want: []int{}},
+		"zero limit":        {offset: 1, limit: 0, want: []int{}},
+		"negative offset":   {offset: -1, limit: 2, wantErr: orderedset.ErrIndexOutOfRange},
+		"negative limit":    {offset: 0, limit: -2, wantErr: orderedset.ErrInvalidRange},
+	} {
+		t.Run(n, func(t *testing.T) {
+			items, total, err := s.Page(tc.offset, tc.limit)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Page(%d, %d) error = %v, wantErr %v", tc.offset, tc.limit, err, tc.wantErr)
+				return
+			}
+			if err == nil && (!reflect.DeepEqual(items, tc.want) || total != 5) {
+				t.Errorf("Page(%d, %d) = (%v, %d), want (%v, 5)", tc.offset, tc.limit, items, total, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitAt(t *testing.T) {
+	s := orderedset.New[int]()
+	for i := 1; i <= 4; i++ {
+		s.Add(i)
+	}
+
+	for n, tc := range map[string]struct {
+		index     int
+		wantLeft  []int
+		wantRight []int
+		wantErr   error
+	}{
+		"split at 0":          {index: 0, wantLeft: []int{}, wantRight: []int{1, 2, 3, 4}},
+		"split at middle":     {index: 2, wantLeft: []int{1, 2}, wantRight: []int{3, 4}},
+		"split at len":        {index: 4, wantLeft: []int{1, 2, 3, 4}, wantRight: []int{}},
+		"invalid index < 0":   {index: -1, wantErr: orderedset.ErrIndexOutOfRange},
+		"invalid index > len": {index: 5, wantErr: orderedset.ErrIndexOutOfRange},
+	} {
+		t.Run(n, func(t *testing.T) {
+			left, right, err := s.SplitAt(tc.index)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("SplitAt(%d) error = %v, wantErr %v", tc.index, err, tc.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(left.Values(), tc.wantLeft) || !reflect.DeepEqual(right.Values(), tc.wantRight) {
+				t.Errorf("SplitAt(%d) = (%v, %v), want (%v, %v)", tc.index, left.Values(), right.Values(), tc.wantLeft, tc.wantRight)
+			}
+		})
+	}
+}
+
+func TestSplitBy(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(7, 2, 5, 9, 1, 5))
+
+	lo, hi := s.SplitBy(5, func(a, b int) bool { return a < b })
+	if expected := []int{2, 1}; !reflect.DeepEqual(lo.Values(), expected) {
+		t.Errorf("SplitBy failed: got lo %v, want %v", lo.Values(), expected)
+	}
+	if expected := []int{7, 5, 9}; !reflect.DeepEqual(hi.Values(), expected) {
+		t.Errorf("SplitBy failed: got hi %v, want %v", hi.Values(), expected)
+	}
+}
+
+func TestTakeWhileDropWhile(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(1, 3, 5, 6, 7, 9))
+	odd := func(v int) bool { return v%2 == 1 }
+
+	if got, want := s.TakeWhile(odd).Values(), []int{1, 3, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TakeWhile failed: got %v, want %v", got, want)
+	}
+	if got, want := s.DropWhile(odd).Values(), []int{6, 7, 9}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DropWhile failed: got %v, want %v", got, want)
+	}
+
+	always := func(int) bool { return true }
+	if s.TakeWhile(always).Len() != s.Len() || s.DropWhile(always).Len() != 0 {
+		t.Error("TakeWhile failed: expected a predicate satisfied by every element to take the whole set")
+	}
+}
+
+func TestZipWith(t *testing.T) {
+	names := orderedset.New[string]()
+	names.Add("alice")
+	names.Add("bob")
+	names.Add("carol")
+
+	ages := orderedset.New[int]()
+	ages.Add(30)
+	ages.Add(25)
+
+	zipped := orderedset.ZipWith(names, ages, func(name string, age int) string {
+		return fmt.Sprintf("%s:%d", name, age)
+	})
+	expected := []string{"alice:30", "bob:25"}
+	if !reflect.DeepEqual(zipped.Values(), expected) {
+		t.Errorf("ZipWith failed: got %v, want %v", zipped.Values(), expected)
+	}
+}
+
+func TestMapSeq(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(1, 2, 3, 4))
+	half := func(v int) int { return v / 2 }
+
+	eager := orderedset.New[int]()
+	for _, v := range s.Values() {
+		eager.Add(half(v))
+	}
+	collected := orderedset.Collect(orderedset.MapSeq(s, half))
+	if !reflect.DeepEqual(collected.Values(), eager.Values()) {
+		t.Errorf("MapSeq failed: got %v, want %v", collected.Values(), eager.Values())
+	}
+
+	var calls int
+	for range orderedset.MapSeq(s, func(v int) string {
+		calls++
+		return strconv.Itoa(v)
+	}) {
+		break
+	}
+	if calls != 1 {
+		t.Errorf("MapSeq failed: got %d calls to f, want 1", calls)
+	}
+}
+
+func TestFilterMap(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial("1", "two", "3", "03", "4x"))
+
+	parsed := orderedset.FilterMap(s, func(v string) (int, bool) {
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	})
+	expected := []int{1, 3}
+	if !reflect.DeepEqual(parsed.Values(), expected) {
+		t.Errorf("FilterMap failed: got %v, want %v", parsed.Values(), expected)
+	}
+}
+
+func TestWalkNested(t *testing.T) {
+	walk := func(graph map[string][]string, limit int) []string {
+		children := func(v string) *orderedset.OrderedSet[string] {
+			if next, ok := graph[v]; ok {
+				return orderedset.New(orderedset.WithInitial(next...))
+			}
+			return nil
+		}
+		var visited []string
+		orderedset.WalkNested(children("root"), children, func(path []string, v string) bool {
+			visited = append(visited, strings.Join(append(slices.Clone(path), v), "/"))
+			return len(visited) < limit
+		})
+		return visited
+	}
+
+	dag := map[string][]string{"root": {"a", "b"}, "a": {"c"}, "b": {"c", "d"}}
+	expected := []string{"a", "a/c", "b", "b/c", "b/d"}
+	if got := walk(dag, 100); !reflect.DeepEqual(got, expected) {
+		t.Errorf("WalkNested failed: got %v, want %v", got, expected)
+	}
+	if got := walk(dag, 3); !reflect.DeepEqual(got, expected[:3]) {
+		t.Errorf("WalkNested failed: got %v after stopping, want %v", got, expected[:3])
+	}
+
+	cyclic := map[string][]string{"root": {"a"}, "a": {"b"}, "b": {"a", "c"}}
+	expected = []string{"a", "a/b", "a/b/c"}
+	if got := walk(cyclic, 100); !reflect.DeepEqual(got, expected) {
+		t.Errorf("WalkNested failed: got %v for a cycle, want %v", got, expected)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	a := orderedset.New(orderedset.WithInitial(1, 2, 3))
+	b := orderedset.New(orderedset.WithInitial(4, 3, 1, 5))
+
+	expected := []orderedset.Classified[int]{
+		{Value: 1, Origin: orderedset.Both},
+		{Value: 2, Origin: orderedset.OnlyA},
+		{Value: 3, Origin: orderedset.Both},
+		{Value: 4, Origin: orderedset.OnlyB},
+		{Value: 5, Origin: orderedset.OnlyB},
+	}
+	if got := orderedset.Classify(a, b); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Classify failed: got %v, want %v", got, expected)
+	}
+
+	for _, c := range orderedset.Classify(a, a) {
+		if c.Origin != orderedset.Both {
+			t.Errorf("Classify failed: got %v for %d in a set compared with itself, want Both", c.Origin, c.Value)
+		}
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	s1 := orderedset.New[int]()
+	s2 := orderedset.New[int]()
+	for _, v := range []int{1, 2, 3, 4, 5} {
+		s1.Add(v)
+	}
+	s2.Add(4)
+	s2.Add(2)
+	s2.Add(9)
+
+	s1.Subtract(s2)
+	expected := []int{1, 3, 5}
+	if !reflect.DeepEqual(s1.Values(), expected) {
+		t.Errorf("Subtract failed: got %v, want %v", s1.Values(), expected)
+	}
+	if idx := s1.IndexOf(5); idx != 2 {
+		t.Errorf("Subtract failed: IndexOf(5) got %d, want 2", idx)
+	}
+}
+
+func TestSetOperationSeqs(t *testing.T) {
+	a := orderedset.New(orderedset.WithInitial(5, 1, 2, 3))
+	b := orderedset.New(orderedset.WithInitial(3, 4, 5))
+
+	for n, tc := range map[string]struct {
+		seq   iter.Seq[int]
+		eager *orderedset.OrderedSet[int]
+	}{
+		"Union":          {seq: a.UnionSeq(b), eager: a.Union(b)},
+		"Intersect":      {seq: a.IntersectSeq(b), eager: a.Intersect(b)},
+		"Difference":     {seq: a.DifferenceSeq(b), eager: a.Difference(b)},
+		"UnionSelf":      {seq: a.UnionSeq(a), eager: a.Union(a)},
+		"IntersectSelf":  {seq: a.IntersectSeq(a), eager: a.Intersect(a)},
+		"DifferenceSelf": {seq: a.DifferenceSeq(a), eager: a.Difference(a)},
+	} {
+		t.Run(n, func(t *testing.T) {
+			if got := orderedset.Collect(tc.seq); !reflect.DeepEqual(got.Values(), tc.eager.Values()) {
+				t.Errorf("%sSeq failed: got %v, want %v", n, got.Values(), tc.eager.Values())
+			}
+		})
+	}
+}
+
+func TestOrderedDiff(t *testing.T) {
+	for n, tt := range map[string]struct {
+		from, to              []int
+		added, removed, moved []int
+	}{
+		"adds":     {from: []int{1, 2}, to: []int{1, 2, 3, 4}, added: []int{3, 4}},
+		"removes":  {from: []int{1, 2, 3, 4}, to: []int{1, 3}, removed: []int{2, 4}, moved: []int{3}},
+		"reorders": {from: []int{1, 2, 3, 4}, to: []int{1, 3, 2, 4}, moved: []int{2, 3}},
+		"mixed":    {from: []int{1, 2, 3}, to: []int{3, 2, 5}, added: []int{5}, removed: []int{1}, moved: []int{3}},
+		"equal":    {from: []int{1, 2}, to: []int{1, 2}},
+	} {
+		t.Run(n, func(t *testing.T) {
+			from := orderedset.New(orderedset.WithInitial(tt.from...))
+			to := orderedset.New(orderedset.WithInitial(tt.to...))
+
+			added, removed, moved := from.OrderedDiff(to)
+			if !reflect.DeepEqual(added, tt.added) || !reflect.DeepEqual(removed, tt.removed) || !reflect.DeepEqual(moved, tt.moved) {
+				t.Errorf("OrderedDiff failed: got (%v, %v, %v), want (%v, %v, %v)",
+					added, removed, moved, tt.added, tt.removed, tt.moved)
+			}
+		})
+	}
+}
+
+func TestEditScript(t *testing.T) {
+	replay := func(values []string, ops []orderedset.EditOp[string]) []string {
+		for _, op := range ops {
+			if i := slices.Index(values, op.Value); i >= 0 {
+				values = slices.Delete(values, i, i+1)
+			}
+			if op.Kind != orderedset.EditDelete {
+				values = slices.Insert(values, op.Index, op.Value)
+			}
+		}
+		return values
+	}
+
+	for n, tc := range map[string]struct {
+		from, to []string
+		ops      int
+	}{
+		"insert only": {from: []string{"b", "d"}, to: []string{"a", "b", "c", "d", "e"}, ops: 3},
+		"delete only": {from: []string{"a", "b", "c", "d"}, to: []string{"b", "d"}, ops: 2},
+		"reorder":     {from: []string{"d", "a", "b", "c"}, to: []string{"a", "b", "c", "d"}, ops: 1},
+		"reverse":     {from: []string{"a", "b", "c"}, to: []string{"c", "b", "a"}, ops: 2},
+		"mixed":       {from: []string{"a", "b", "c", "d"}, to: []string{"e", "c", "a", "d"}, ops: 3},
+		"equal":       {from: []string{"a", "b"}, to: []string{"a", "b"}, ops: 0},
+		"from empty":  {to: []string{"a", "b"}, ops: 2},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New(orderedset.WithInitial(tc.from...))
+			ops := s.EditScript(orderedset.New(orderedset.WithInitial(tc.to...)))
+			if len(ops) != tc.ops {
+				t.Errorf("EditScript failed: got %d operations %v, want %d", len(ops), ops, tc.ops)
+			}
+			if got := replay(s.Values(), ops); !slices.Equal(got, tc.to) {
+				t.Errorf("EditScript failed: replaying %v gives %v, want %v", ops, got, tc.to)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial("a", "b", "c", "d"))
+	target := orderedset.New(orderedset.WithInitial("e", "c", "a", "d"))
+	if err := s.Apply(s.EditScript(target)); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !reflect.DeepEqual(s.Values(), target.Values()) {
+		t.Errorf("Apply failed: got %v, want %v", s.Values(), target.Values())
+	}
+	if idx := s.IndexOf("a"); idx != 2 {
+		t.Errorf("Apply failed: IndexOf(a) got %d, want 2", idx)
+	}
+
+	for n, tc := range map[string]struct {
+		op   orderedset.EditOp[string]
+		want error
+	}{
+		"delete absent":     {op: orderedset.EditOp[string]{Kind: orderedset.EditDelete, Value: "z"}, want: orderedset.ErrNotFound},
+		"move absent":       {op: orderedset.EditOp[string]{Kind: orderedset.EditMove, Value: "z", Index: 0}, want: orderedset.ErrNotFound},
+		"move out of range": {op: orderedset.EditOp[string]{Kind: orderedset.EditMove, Value: "a", Index: 4}, want: orderedset.ErrIndexOutOfRange},
+		"insert present":    {op: orderedset.EditOp[string]{Kind: orderedset.EditInsert, Value: "a", Index: 0}, want: orderedset.ErrAlreadyPresent},
+		"insert past end":   {op: orderedset.EditOp[string]{Kind: orderedset.EditInsert, Value: "z", Index: 5}, want: orderedset.ErrIndexOutOfRange},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New(orderedset.WithInitial("a", "b", "c"))
+			ops := []orderedset.EditOp[string]{
+				{Kind: orderedset.EditInsert, Value: "d", Index: 3},
+				{Kind: orderedset.EditMove, Value: "c", Index: 0},
+				tc.op,
+			}
+			if err := s.Apply(ops); !errors.Is(err, tc.want) {
+				t.Errorf("Apply failed: got error %v, want %v", err, tc.want)
+			}
+			if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(s.Values(), expected) {
+				t.Errorf("Apply rollback failed: got %v, want %v", s.Values(), expected)
+			}
+		})
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	for n, tc := range map[string]struct {
+		a, b []int
+		want []int
+	}{
+		"equal":     {a: []int{1, 2, 3}, b: []int{1, 2, 3}, want: []int{1, 2, 3}},
+		"divergent": {a: []int{1, 2, 3}, b: []int{3, 2, 1}, want: []int{}},
+		"partial":   {a: []int{1, 2, 3, 4}, b: []int{1, 2, 4}, want: []int{1, 2}},
+		"shorter":   {a: []int{1, 2}, b: []int{1, 2, 3}, want: []int{1, 2}},
+	} {
+		t.Run(n, func(t *testing.T) {
+			a := orderedset.New(orderedset.WithInitial(tc.a...))
+			b := orderedset.New(orderedset.WithInitial(tc.b...))
+			if got := a.CommonPrefix(b).Values(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("CommonPrefix(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	for n, tc := range map[string]struct {
+		a, b []int
+		want float64
+	}{
+		"identical":   {a: []int{1, 2, 3}, b: []int{3, 2, 1}, want: 1},
+		"disjoint":    {a: []int{1, 2}, b: []int{3, 4}, want: 0},
+		"overlapping": {a: []int{1, 2, 3}, b: []int{2, 3, 4, 5}, want: 0.4},
+		"one empty":   {a: []int{1}, b: nil, want: 0},
+		"both empty":  {want: 1},
+	} {
+		t.Run(n, func(t *testing.T) {
+			a := orderedset.New(orderedset.WithInitial(tc.a...))
+			b := orderedset.New(orderedset.WithInitial(tc.b...))
+			if got := a.Jaccard(b); got != tc.want {
+				t.Errorf("Jaccard(%v, %v) = %v, want %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelfOperations(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(1, 2, 3))
+	expected := []int{1, 2, 3}
+
+	for n, op := range map[string]func() *orderedset.OrderedSet[int]{
+		"Union":              func() *orderedset.OrderedSet[int] { return s.Union(s) },
+		"Intersect":          func() *orderedset.OrderedSet[int] { return s.Intersect(s) },
+		"IntersectBySmaller": func() *orderedset.OrderedSet[int] { return s.IntersectBySmaller(s) },
+	} {
+		t.Run(n, func(t *testing.T) {
+			result := op()
+			if result == s || !reflect.DeepEqual(result.Values(), expected) {
+				t.Errorf("%s failed: got %v, want a clone with %v", n, result.Values(), expected)
+			}
+		})
+	}
+
+	if d := s.Difference(s); d.Len() != 0 {
+		t.Errorf("Difference failed: got %v, want []", d.Values())
+	}
+	if err := s.InsertSetAt(1, s); err != nil || !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("InsertSetAt failed: got (%v, %v), want (%v, nil)", s.Values(), err, expected)
+	}
+	if err := s.InsertSetAt(4, s); !errors.Is(err, orderedset.ErrIndexOutOfRange) {
+		t.Errorf("InsertSetAt failed: got error %v, want ErrIndexOutOfRange", err)
+	}
+
+	s.Subtract(s)
+	if s.Len() != 0 {
+		t.Errorf("Subtract failed: got %v, want []", s.Values())
+	}
+}
+
+func TestMirroredOperationsConcurrent(t *testing.T) {
+	a := orderedset.New[int]()
+	b := orderedset.New[int]()
+	for i := range 10000 {
+		a.Add(i)
+		b.Add(-i)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		s, other := a, b
+		if i%2 == 1 {
+			s, other = b, a
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				s.Intersect(other)
+				s.IntersectBySmaller(other)
+				s.Difference(other)
+				s.Subtract(other)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("mirrored operations deadlocked")
+	}
+}
+
+func BenchmarkSubtract(b *testing.B) {
+	other := orderedset.New[int]()
+	for i := 0; i < 10000; i += 2 {
+		other.Add(i)
+	}
+	build := func() *orderedset.OrderedSet[int] {
+		s := orderedset.New[int]()
+		for i := range 10000 {
+			s.Add(i)
+		}
+		return s
+	}
+
+	b.Run("Difference", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			b.StopTimer()
+			s := build()
+			b.StartTimer()
+			s = s.Difference(other)
+		}
+	})
+
+	b.Run("Subtract", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			b.StopTimer()
+			s := build()
+			b.StartTimer()
+			s.Subtract(other)
+		}
+	})
+}
+
+func TestFlatten(t *testing.T) {
+	s1 := orderedset.New(orderedset.WithInitial(1, 2))
+	s2 := orderedset.New(orderedset.WithInitial(3, 1))
+
+	expected := []int{1, 2, 3}
+	if got := orderedset.Flatten(s1, s2).Values(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Flatten failed: got %v, want %v", got, expected)
+	}
+}
+
+func TestFlattenSlices(t *testing.T) {
+	flat := orderedset.FlattenSlices([]int{3, 1, 3}, []int{2, 1}, []int{4, 2, 5})
+
+	expected := []int{3, 1, 2, 4, 5}
+	if !reflect.DeepEqual(flat.Values(), expected) {
+		t.Errorf("FlattenSlices failed: got %v, want %v", flat.Values(), expected)
+	}
+}
+
+func TestIntersectionCounts(t *testing.T) {
+	s1 := orderedset.New[string]()
+	s2 := orderedset.New[string]()
+	s3 := orderedset.New[string]()
+	for _, v := range []string{"go", "rust", "zig"} {
+		s1.Add(v)
+	}
+	for _, v := range []string{"rust", "go", "c"} {
+		s2.Add(v)
+	}
+	for _, v := range []string{"go", "c"} {
+		s3.Add(v)
+	}
+
+	all, counts := orderedset.IntersectionCounts(s1, s2, s3)
+	expectedAll := []string{"go", "rust", "zig", "c"}
+	if !reflect.DeepEqual(all.Values(), expectedAll) {
+		t.Errorf("IntersectionCounts failed: got %v, want %v", all.Values(), expectedAll)
+	}
+	expectedCounts := map[string]int{"go": 3, "rust": 2, "zig": 1, "c": 2}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Errorf("IntersectionCounts failed: got %v, want %v", counts, expectedCounts)
+	}
+
+	expected := []string{"go", "rust", "c"}
+	if got := orderedset.AtLeast(2, s1, s2, s3).Values(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("AtLeast failed: got %v, want %v", got, expected)
+	}
+	expected = []string{"go"}
+	if got := orderedset.AtLeast(3, s1, s2, s3).Values(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("AtLeast failed: got %v, want %v", got, expected)
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(3, 1, 4, 5))
+
+	sums := orderedset.Scan(s, 0, func(acc, v int) int { return acc + v })
+	if expected := []int{3, 4, 8, 13}; !reflect.DeepEqual(sums, expected) {
+		t.Errorf("Scan failed: got %v, want %v", sums, expected)
+	}
+	if empty := orderedset.Scan(orderedset.New[int](), 0, func(acc, v int) int { return acc + v }); len(empty) != 0 {
+		t.Errorf("Scan failed: got %v for an empty set, want []", empty)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	words := orderedset.New(orderedset.WithInitial("go", "rust", "c", "java", "zig", "ml", "d"))
+
+	keys, counts := orderedset.Histogram(words, func(w string) int { return len(w) })
+	if expected := []int{2, 4, 1, 3}; !reflect.DeepEqual(keys.Values(), expected) {
+		t.Errorf("Histogram failed: got keys %v, want %v", keys.Values(), expected)
+	}
+	if expected := map[int]int{1: 2, 2: 2, 3: 1, 4: 2}; !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Histogram failed: got counts %v, want %v", counts, expected)
+	}
+}
+
+func TestCountRuns(t *testing.T) {
+	type event struct {
+		ID   int
+		Kind string
+	}
+	kind := func(e event) string { return e.Kind }
+
+	for n, tc := range map[string]struct {
+		kinds []string
+		want  int
+	}{
+		"empty":         {kinds: nil, want: 0},
+		"all same":      {kinds: []string{"A", "A", "A"}, want: 1},
+		"all different": {kinds: []string{"A", "B", "C"}, want: 3},
+		"mixed":         {kinds: []string{"A", "A", "B", "A"}, want: 3},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New[event]()
+			for i, k := range tc.kinds {
+				s.Add(event{ID: i, Kind: k})
+			}
+			if got := orderedset.CountRuns(s, kind); got != tc.want {
+				t.Errorf("CountRuns(%v) = %d, want %d", tc.kinds, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(3)
+	s.Add(1)
+	s.Add(2)
+
+	s.SortBy(func(a, b int) bool { return a < b })
+	expectedAsc := []int{1, 2, 3}
+	if !reflect.DeepEqual(s.Values(), expectedAsc) {
+		t.Errorf("SortBy ascending failed: got %v, want %v", s.Values(), expectedAsc)
+	}
+
+	s.SortBy(func(a, b int) bool { return a > b })
+	expectedDesc := []int{3, 2, 1}
+	if !reflect.DeepEqual(s.Values(), expectedDesc) {
+		t.Errorf("SortBy descending failed: got %v, want %v", s.Values(), expectedDesc)
+	}
+}
+
+func TestPin(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+	s := orderedset.New(orderedset.WithInitial(5, 3, 8, 1, 9, 2))
+	s.Pin(8)
+	s.Pin(3)
+	s.Pin(7)
+
+	s.SortBy(less)
+	expected := []int{3, 8, 1, 2, 5, 9}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("SortBy with pins failed: got %v, want %v", s.Values(), expected)
+	}
+	if idx := s.IndexOf(8); idx != 1 {
+		t.Errorf("SortBy with pins failed: IndexOf(8) got %d, want 1", idx)
+	}
+
+	if removed := s.RemoveIter(func(v int) bool { return v > 2 }); removed != 2 {
+		t.Errorf("RemoveIter with pins failed: got %d removed, want 2", removed)
+	}
+	expected = []int{3, 8, 1, 2}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("RemoveIter with pins failed: got %v, want %v", s.Values(), expected)
+	}
+
+	s.Subtract(orderedset.New(orderedset.WithInitial(1, 3)))
+	expected = []int{3, 8, 2}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Subtract with pins failed: got %v, want %v", s.Values(), expected)
+	}
+
+	s.Remove(3)
+	s.Unpin(8)
+	s.Add(3)
+	s.SortBy(less)
+	expected = []int{2, 3, 8}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("SortBy after Unpin failed: got %v, want %v", s.Values(), expected)
+	}
+}
+
+func TestPinPositionalRemoval(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+	s := orderedset.New(orderedset.WithInitial(1, 2, 3, 4, 5))
+	s.Pin(1)
+	s.Pin(3)
+	s.Pin(5)
+
+	if popped := s.PopN(1); !reflect.DeepEqual(popped, []int{1}) {
+		t.Errorf("PopN with pins failed: got %v, want [1]", popped)
+	}
+	if removed, err := s.RemoveRange(1, 2); err != nil || !reflect.DeepEqual(removed, []int{3}) {
+		t.Errorf("RemoveRange with pins failed: got %v, %v, want [3], nil", removed, err)
+	}
+	s.Add(1)
+	s.Add(3)
+	s.SortBy(less)
+	if expected := []int{5, 1, 2, 3, 4}; !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("SortBy after removing pinned elements failed: got %v, want %v", s.Values(), expected)
+	}
+
+	bounded := orderedset.New(orderedset.WithBounded[int](2), orderedset.WithInitial(1, 2))
+	bounded.Pin(1)
+	bounded.Add(3)
+	bounded.ReplaceContents([]int{3, 1, 2})
+	bounded.SortBy(func(a, b int) bool { return a > b })
+	if expected := []int{2, 1}; !reflect.DeepEqual(bounded.Values(), expected) {
+		t.Errorf("WithBounded with pins failed: got %v, want %v", bounded.Values(), expected)
+	}
+}
+
+func TestPinSwap(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+	a := orderedset.New(orderedset.WithInitial(9, 8))
+	b := orderedset.New(orderedset.WithInitial(5, 4, 3, 2, 1))
+	a.Pin(9)
+	b.Pin(3)
+
+	orderedset.Swap(a, b)
+	a.SortBy(less)
+	b.SortBy(less)
+	if expected := []int{3, 1, 2, 4, 5}; !reflect.DeepEqual(a.Values(), expected) {
+		t.Errorf("SortBy after Swap failed: got %v, want %v", a.Values(), expected)
+	}
+	if expected := []int{9, 8}; !reflect.DeepEqual(b.Values(), expected) {
+		t.Errorf("SortBy after Swap failed: got %v, want %v", b.Values(), expected)
+	}
+
+	c := orderedset.New(orderedset.WithInitial(1, 2, 3))
+	c.Pin(1)
+	c.Pin(2)
+	c.Pin(3)
+	orderedset.Swap(c, orderedset.New[int]())
+	c.SortBy(less)
+	if c.Len() != 0 {
+		t.Errorf("SortBy after Swap failed: got %v, want []", c.Values())
+	}
+}
+
+func TestNewSorted(t *testing.T) {
+	s := orderedset.NewSorted(func(a, b int) bool { return a < b })
+	for _, v := range []int{5, 3, 9, 1, 3, 7, 2, 8, 6, 4, 0} {
+		s.Add(v)
+	}
+
+	expected := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("NewSorted failed: got %v, want %v", s.Values(), expected)
+	}
+
+	s.SortBy(func(a, b int) bool { return a > b })
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("SortBy on sorted set failed: got %v, want %v", s.Values(), expected)
+	}
+
+	union := s.Union(orderedset.New[int]())
+	union.Add(-1)
+	if v, _ := union.At(0); v != -1 {
+		t.Errorf("Clone of sorted set failed: got %v at index 0, want -1", v)
+	}
+
+	if err := json.Unmarshal([]byte(`[3,1,2]`), s); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(s.Values(), []int{1, 2, 3}) {
+		t.Errorf("Unmarshal into sorted set failed: got %v, want [1 2 3]", s.Values())
+	}
+}
+
+func TestTopN(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(5, 1, 9, 3, 7, 2, 8))
+	less := func(a, b int) bool { return a < b }
+
+	expected := []int{9, 8, 7}
+	if got := s.TopN(3, less); !reflect.DeepEqual(got, expected) {
+		t.Errorf("TopN failed: got %v, want %v", got, expected)
+	}
+
+	expected = []int{9, 8, 7, 5, 3, 2, 1}
+	if got := s.TopN(10, less); !reflect.DeepEqual(got, expected) {
+		t.Errorf("TopN failed: got %v, want %v", got, expected)
+	}
+
+	if got := s.TopN(0, less); len(got) != 0 {
+		t.Errorf("TopN failed: got %v, want empty", got)
+	}
+}
+
+func BenchmarkTopN(b *testing.B) {
+	s := orderedset.New[int]()
+	for i := range 100000 {
+		s.Add((i * 7919) % 100003)
+	}
+	less := func(a, b int) bool { return a < b }
+
+	b.Run("TopN", func(b *testing.B) {
+		for b.Loop() {
+			s.TopN(10, less)
+		}
+	})
+
+	b.Run("SortBy", func(b *testing.B) {
+		for b.Loop() {
+			sorted := s.Clone()
+			sorted.SortBy(func(a, b int) bool { return a > b })
+			_, _ = sorted.Slice(0, 10)
+		}
+	})
+}
+
+func TestMinByMaxBy(t *testing.T) {
+	s := orderedset.New(orderedset.WithInitial(
+		user{ID: 2, Name: "bob"},
+		user{ID: 1, Name: "carol"},
+		user{ID: 3, Name: "alice"},
+		user{ID: 4, Name: "alice"},
+	))
+	byName := func(a, b user) bool { return a.Name < b.Name }
+
+	if got, ok := s.MinBy(byName); !ok || got.ID != 3 {
+		t.Errorf("MinBy failed: got (%v, %v), want ({3 alice}, true)", got, ok)
+	}
+	if got, ok := s.MaxBy(byName); !ok || got.ID != 1 {
+		t.Errorf("MaxBy failed: got (%v, %v), want ({1 carol}, true)", got, ok)
+	}
+
+	empty := orderedset.New[user]()
+	if _, ok := empty.MinBy(byName); ok {
+		t.Error("MinBy failed: expected false for an empty set")
+	}
+	if _, ok := empty.MaxBy(byName); ok {
+		t.Error("MaxBy failed: expected false for an empty set")
+	}
+}
+
+func TestBinarySearch(t *testing.T) {
+	s := orderedset.FromSortedSlice([]int{1, 3, 3, 5, 7, 9})
+	if !reflect.DeepEqual(s.Values(), []int{1, 3, 5, 7, 9}) {
+		t.Fatalf("FromSortedSlice failed: got %v, want [1 3 5 7 9]", s.Values())
+	}
+
+	for n, tc := range map[string]struct {
+		target int
+		pos    int
+		found  bool
+	}{
+		"first":        {target: 1, pos: 0, found: true},
+		"middle":       {target: 5, pos: 2, found: true},
+		"last":         {target: 9, pos: 4, found: true},
+		"missing":      {target: 4, pos: 2, found: false},
+		"before first": {target: 0, pos: 0, found: false},
+		"after last":   {target: 10, pos: 5, found: false},
+	} {
+		t.Run(n, func(t *testing.T) {
+			pos, found := orderedset.BinarySearch(s, tc.target)
+			if pos != tc.pos || found != tc.found {
+				t.Errorf("BinarySearch(%d) = %d, %v, want %d, %v", tc.target, pos, found, tc.pos, tc.found)
+			}
+		})
+	}
+
+	values := s.Values()
+	slices.Reverse(values)
+	if !reflect.DeepEqual(s.Values(), []int{1, 3, 5, 7, 9}) {
+		t.Errorf("Values failed: modifying the copy changed the set, got %v", s.Values())
+	}
+}
+
+func TestIsSorted(t *testing.T) {
+	for n, tc := range map[string]struct {
+		values []int
+		want   bool
+	}{
+		"empty":          {values: nil, want: true},
+		"sorted":         {values: []int{1, 2, 3}, want: true},
+		"reverse sorted": {values: []int{3, 2, 1}, want: false},
+		"mixed":          {values: []int{1, 3, 2}, want: false},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New(orderedset.WithInitial(tc.values...))
+			if got := orderedset.IsSorted(s); got != tc.want {
+				t.Errorf("IsSorted(%v) = %v, want %v", tc.values, got, tc.want)
+			}
+			if got := s.IsSortedBy(func(a, b int) bool { return a < b }); got != tc.want {
+				t.Errorf("IsSortedBy(%v) = %v, want %v", tc.values, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(3)
+	s.Add(1)
+	s.Add(2)
+
+	sorted := s.OrderBy(func(a, b int) bool { return a < b })
+	expected := []int{1, 2, 3}
+	if !reflect.DeepEqual(sorted.Values(), expected) {
+		t.Errorf("OrderBy failed: got %v, want %v", sorted.Values(), expected)
+	}
+
+	original := []int{3, 1, 2}
+	if !reflect.DeepEqual(s.Values(), original) {
+		t.Errorf("OrderBy failed: original modified, got %v, want %v", s.Values(), original)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	wantJSON := `[1,2]`
+	if string(b) != wantJSON {
+		t.Errorf("Marshal JSON failed: got %s, want %s", string(b), wantJSON)
+	}
+}
+
+func TestSameJSON(t *testing.T) {
+	type point struct {
+		X      int
+		hidden int
+	}
+	for n, tc := range map[string]struct {
+		a, b []point
+		want bool
+	}{
+		"equal":           {a: []point{{X: 1}, {X: 2}}, b: []point{{X: 1}, {X: 2}}, want: true},
+		"both empty":      {want: true},
+		"different order": {a: []point{{X: 1}, {X: 2}}, b: []point{{X: 2}, {X: 1}}, want: false},
+		"different size":  {a: []point{{X: 1}}, b: []point{{X: 1}, {X: 2}}, want: false},
+		"same encoding":   {a: []point{{X: 1, hidden: 1}}, b: []point{{X: 1, hidden: 2}}, want: true},
+	} {
+		t.Run(n, func(t *testing.T) {
+			a := orderedset.New(orderedset.WithInitial(tc.a...))
+			b := orderedset.New(orderedset.WithInitial(tc.b...))
+			same, err := a.SameJSON(b)
+			if err != nil {
+				t.Fatalf("SameJSON failed: %v", err)
+			}
+			if same != tc.want {
+				t.Errorf("SameJSON failed: got %v, want %v", same, tc.want)
+			}
+		})
+	}
+
+	zero := orderedset.New(orderedset.WithInitial(0.0))
+	negative := orderedset.New(orderedset.WithInitial(math.Copysign(0, -1)))
+	if same, err := zero.SameJSON(negative); err != nil || same {
+		t.Errorf("SameJSON failed: got %v, %v for [0] and [-0], want false, nil", same, err)
+	}
+
+	errEncode := errors.New("encode")
+	a := orderedset.New(orderedset.WithInitial(1))
+	a.SetElementCodec(func(int) (json.RawMessage, error) { return nil, errEncode }, nil)
+	if _, err := a.SameJSON(orderedset.New(orderedset.WithInitial(1))); !errors.Is(err, errEncode) {
+		t.Errorf("SameJSON failed: got error %v, want %v", err, errEncode)
+	}
+}
+
+type pointerMarshaler struct {
+	A int
+}
+
+func (*pointerMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`"custom"`), nil
+}
+
+func TestEncodeJSON(t *testing.T) {
+	for n, values := range map[string][]string{
+		"empty":    {},
+		"single":   {"a"},
+		"multiple": {"a", "<b>", "c\"d"},
+	} {
+		t.Run(n, func(t *testing.T) {
+			s := orderedset.New[string]()
+			for _, v := range values {
+				s.Add(v)
+			}
+
+			var buf bytes.Buffer
+			if err := s.EncodeJSON(&buf); err != nil {
+				t.Fatalf("EncodeJSON failed: %v", err)
+			}
+			want, err := json.Marshal(s)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if buf.String() != string(want) {
+				t.Errorf("EncodeJSON failed: got %s, want %s", buf.String(), want)
+			}
+		})
+	}
+
+	bytesSet := orderedset.New(orderedset.WithInitial[byte](1, 2, 3))
+	pointerSet := orderedset.New(orderedset.WithInitial(pointerMarshaler{1}, pointerMarshaler{2}))
+	codecSet := orderedset.New(orderedset.WithInitial(1, 2))
+	codecSet.SetElementCodec(func(v int) (json.RawMessage, error) {
+		return json.RawMessage(fmt.Sprintf("{ \"n\" : %d }", v)), nil
+	}, nil)
+
+	for name, tc := range map[string]struct {
+		s    json.Marshaler
+		enc  func(w io.Writer) error
+		want string
+	}{
+		"bytes":   {bytesSet, bytesSet.EncodeJSON, `"AQID"`},
+		"pointer": {pointerSet, pointerSet.EncodeJSON, `["custom","custom"]`},
+		"codec":   {codecSet, codecSet.EncodeJSON, `[{"n":1},{"n":2}]`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tc.enc(&buf); err != nil {
+				t.Fatalf("EncodeJSON failed: %v", err)
+			}
+			marshaled, err := tc.s.MarshalJSON()
+			if err != nil {
+				t.Fatalf("MarshalJSON failed: %v", err)
+			}
+			if buf.String() != tc.want || string(marshaled) != tc.want {
+				t.Errorf("EncodeJSON failed: got %s and MarshalJSON %s, want %s", buf.String(), marshaled, tc.want)
+			}
+		})
+	}
+
+	data, err := bytesSet.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	decoded := orderedset.New[byte]()
+	if err := decoded.DecodeJSON(bytes.NewReader(data)); err != nil {
+		t.Fatalf("DecodeJSON failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Values(), []byte{1, 2, 3}) {
+		t.Errorf("DecodeJSON failed: got %v, want [1 2 3]", decoded.Values())
+	}
+}
+
+func TestJSONStructFields(t *testing.T) {
+	type document struct {
+		Ptr   *orderedset.OrderedSet[int] `json:"ptr"`
+		Val   orderedset.OrderedSet[int]  `json:"val"`
+		Empty orderedset.OrderedSet[int]  `json:"empty"`
+		Nil   *orderedset.OrderedSet[int] `json:"nil"`
+	}
+	doc := &document{Ptr: orderedset.New(orderedset.WithInitial(1, 2))}
+	doc.Val.Add(3)
+	doc.Val.Add(4)
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if expected := `{"ptr":[1,2],"val":[3,4],"empty":[],"nil":null}`; string(data) != expected {
+		t.Errorf("Marshal failed: got %s, want %s", data, expected)
+	}
+
+	var decoded document
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Nil != nil {
+		t.Errorf("Unmarshal failed: got %v for a null field, want nil", decoded.Nil.Values())
+	}
+	decoded.Ptr.Add(5)
+	decoded.Val.Add(6)
+	decoded.Empty.Add(7)
+	if !reflect.DeepEqual(decoded.Ptr.Values(), []int{1, 2, 5}) || decoded.Ptr.IndexOf(5) != 2 {
+		t.Errorf("Unmarshal failed: got %v for the pointer field, want [1 2 5]", decoded.Ptr.Values())
+	}
+	if !reflect.DeepEqual(decoded.Val.Values(), []int{3, 4, 6}) || decoded.Val.IndexOf(6) != 2 {
+		t.Errorf("Unmarshal failed: got %v for the value field, want [3 4 6]", decoded.Val.Values())
+	}
+	if !reflect.DeepEqual(decoded.Empty.Values(), []int{7}) {
+		t.Errorf("Unmarshal failed: got %v for the empty field, want [7]", decoded.Empty.Values())
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	input := `[1,2]`
+	s := orderedset.New[int]()
+	err := json.Unmarshal([]byte(input), s)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	expected := []int{1, 2}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Unmarshal JSON failed: got %v, want %v", s.Values(), expected)
+	}
+}
+
+func TestJSONNumbers(t *testing.T) {
+	floats := orderedset.New[float64]()
+	if err := json.Unmarshal([]byte(`[1.0, 2.5, 0.1, 1e21, 1]`), floats); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	expectedFloats := []float64{1, 2.5, 0.1, 1e21}
+	if !reflect.DeepEqual(floats.Values(), expectedFloats) {
+		t.Errorf("Unmarshal JSON failed: got %v, want %v", floats.Values(), expectedFloats)
+	}
+	b, err := json.Marshal(floats)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if wantJSON := `[1,2.5,0.1,1e+21]`; string(b) != wantJSON {
+		t.Errorf("Marshal JSON failed: got %s, want %s", b, wantJSON)
+	}
+	roundTrip := orderedset.New[float64]()
+	if err := json.Unmarshal(b, roundTrip); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(roundTrip.Values(), expectedFloats) {
+		t.Errorf("Round trip failed: got %v, want %v", roundTrip.Values(), expectedFloats)
+	}
+
+	input := `[1.0,2.50,12345678901234567890,1]`
+	numbers := orderedset.New[json.Number]()
+	if err := json.Unmarshal([]byte(input), numbers); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	b, err = json.Marshal(numbers)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(b) != input {
+		t.Errorf("Round trip failed: got %s, want %s", b, input)
+	}
+}
+
+func TestUnmarshalJSONDuplicates(t *testing.T) {
+	input := `[1,2,1,3]`
+
+	s := orderedset.New[int]()
+	if err := json.Unmarshal([]byte(input), s); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	expected := []int{1, 2, 3}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("Unmarshal JSON failed: got %v, want %v", s.Values(), expected)
+	}
+
+	strict := orderedset.New[int]()
+	strict.Add(10)
+	strict.SetStrict(true)
+	err := json.Unmarshal([]byte(input), strict)
+	if err == nil || err.Error() != "duplicate element at index 2" {
+		t.Errorf("Strict unmarshal failed: got error %v, want duplicate element at index 2", err)
+	}
+	if !reflect.DeepEqual(strict.Values(), []int{10}) {
+		t.Errorf("Strict unmarshal failed: set modified on error, got %v", strict.Values())
+	}
+}
+
+func TestUnmarshalJSONNil(t *testing.T) {
+	var s *orderedset.OrderedSet[int]
+	if err := s.UnmarshalJSON([]byte(`[1]`)); err == nil {
+		t.Error("Unmarshal failed: expected error for nil receiver")
+	}
+
+	var zero orderedset.OrderedSet[int]
+	zero.Add(1)
+	if !zero.Has(1) {
+		t.Error("Add failed: zero value set should be usable")
+	}
+}
+
+func TestUnmarshalJSONConcurrent(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := json.Unmarshal([]byte(`[1,2,3]`), s); err != nil {
+				t.Errorf("Unmarshal failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if !s.Has(1) {
+				t.Error("Has failed: expected true for 1")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDecodeJSON(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(10)
+	if err := s.DecodeJSON(bytes.NewReader([]byte(`[3, 1, 3, 2, 1]`))); err != nil {
+		t.Fatalf("DecodeJSON failed: %v", err)
+	}
+
+	expected := []int{3, 1, 2}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("DecodeJSON failed: got %v, want %v", s.Values(), expected)
+	}
+
+	if err := s.DecodeJSON(bytes.NewReader([]byte(`{"a": 1}`))); err == nil {
+		t.Error("DecodeJSON failed: expected error for non-array input")
+	}
+	if err := s.DecodeJSON(bytes.NewReader([]byte(`[1, "a"]`))); err == nil {
+		t.Error("DecodeJSON failed: expected error for invalid element")
+	}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("DecodeJSON failed: set modified on error, got %v", s.Values())
+	}
+
+	s.SetStrict(true)
+	if err := s.DecodeJSON(bytes.NewReader([]byte(`[1, 1]`))); err == nil {
+		t.Error("DecodeJSON failed: expected error for duplicates in strict mode")
+	}
+}
+
+func TestDecodeJSONBounded(t *testing.T) {
+	const input = `[1,2,3,1]`
+	decoded := orderedset.New(orderedset.WithBounded[int](2))
+	if err := decoded.DecodeJSON(strings.NewReader(input)); err != nil {
+		t.Fatalf("DecodeJSON failed: %v", err)
+	}
+	unmarshalled := orderedset.New(orderedset.WithBounded[int](2))
+	if err := json.Unmarshal([]byte(input), unmarshalled); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Values(), unmarshalled.Values()) {
+		t.Errorf("DecodeJSON failed: got %v, want %v as from UnmarshalJSON", decoded.Values(), unmarshalled.Values())
+	}
+
+	strict := orderedset.New(orderedset.WithBounded[int](2))
+	strict.SetStrict(true)
+	if err := strict.DecodeJSON(strings.NewReader(input)); err == nil {
+		t.Error("DecodeJSON failed: expected error for a duplicate of an evicted element in strict mode")
+	}
+}
+
+type point struct {
+	X, Y int
+}
+
+func (p point) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "%d;%d", p.X, p.Y), nil
+}
+
+func TestMarshalText(t *testing.T) {
+	points := orderedset.New(orderedset.WithInitial(point{1, 2}, point{3, 4}))
+	text, err := points.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText failed: %v", err)
+	}
+	if expected := "1;2\n3;4"; string(text) != expected {
+		t.Errorf("MarshalText failed: got %q, want %q", text, expected)
+	}
+
+	ints := orderedset.New(orderedset.WithInitial(10, 20))
+	record, err := ints.MarshalCSVRecord()
+	if err != nil {
+		t.Fatalf("MarshalCSVRecord failed: %v", err)
+	}
+	if expected := []string{"10", "20"}; !reflect.DeepEqual(record, expected) {
+		t.Errorf("MarshalCSVRecord failed: got %v, want %v", record, expected)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	record, _ = points.MarshalCSVRecord()
+	if err := w.Write(record); err != nil {
+		t.Fatalf("csv.Writer failed: %v", err)
+	}
+	w.Flush()
+	if expected := "1;2,3;4\n"; buf.String() != expected {
+		t.Errorf("MarshalCSVRecord failed: got %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestMarshalCompressed(t *testing.T) {
+	s := orderedset.New[string]()
+	for i := range 500 {
+		s.Add(fmt.Sprintf("repetitive-element-%d", i))
+	}
+
+	data, err := s.MarshalCompressed()
+	if err != nil {
+		t.Fatalf("MarshalCompressed failed: %v", err)
+	}
+	plain, err := s.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	if len(data) >= len(plain) {
+		t.Errorf("MarshalCompressed failed: got %d bytes, want fewer than %d", len(data), len(plain))
+	}
+
+	decoded := orderedset.New[string]()
+	if err := decoded.UnmarshalCompressed(data); err != nil {
+		t.Fatalf("UnmarshalCompressed failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Values(), s.Values()) {
+		t.Errorf("UnmarshalCompressed failed: got %v, want %v", decoded.Values(), s.Values())
+	}
+
+	if err := decoded.UnmarshalCompressed(plain); err == nil {
+		t.Error("UnmarshalCompressed failed: expected error for uncompressed input")
+	}
+
+	bytesSet := orderedset.New(orderedset.WithInitial[byte](3, 1, 2))
+	data, err = bytesSet.MarshalCompressed()
+	if err != nil {
+		t.Fatalf("MarshalCompressed failed: %v", err)
+	}
+	decodedBytes := orderedset.New[byte]()
+	if err := decodedBytes.UnmarshalCompressed(data); err != nil {
+		t.Fatalf("UnmarshalCompressed failed: %v", err)
+	}
+	if !reflect.DeepEqual(decodedBytes.Values(), []byte{3, 1, 2}) {
+		t.Errorf("UnmarshalCompressed failed: got %v, want [3 1 2]", decodedBytes.Values())
+	}
+}
+
+func TestSetElementCodec(t *testing.T) {
+	enc := func(v int) (json.RawMessage, error) {
+		return json.Marshal(base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(v))))
+	}
+	dec := func(data json.RawMessage) (int, error) {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return 0, err
+		}
+		b, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(string(b))
+	}
+
+	s := orderedset.New[int]()
+	s.SetElementCodec(enc, dec)
+	s.Add(1)
+	s.Add(22)
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	wantJSON := `["MQ==","MjI="]`
+	if string(b) != wantJSON {
+		t.Errorf("Marshal JSON failed: got %s, want %s", string(b), wantJSON)
+	}
+
+	var buf bytes.Buffer
+	if err := s.EncodeJSON(&buf); err != nil {
+		t.Fatalf("EncodeJSON failed: %v", err)
+	}
+	if buf.String() != wantJSON {
+		t.Errorf("EncodeJSON failed: got %s, want %s", buf.String(), wantJSON)
+	}
+
+	decoded := orderedset.New[int]()
+	decoded.SetElementCodec(enc, dec)
+	if err := json.Unmarshal([]byte(`["Mw==","MjI=","Mw=="]`), decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	expected := []int{3, 22}
+	if !reflect.DeepEqual(decoded.Values(), expected) {
+		t.Errorf("Unmarshal JSON failed: got %v, want %v", decoded.Values(), expected)
+	}
+
+	if err := decoded.DecodeJSON(&buf); err != nil {
+		t.Fatalf("DecodeJSON failed: %v", err)
+	}
+	expected = []int{1, 22}
+	if !reflect.DeepEqual(decoded.Values(), expected) {
+		t.Errorf("DecodeJSON failed: got %v, want %v", decoded.Values(), expected)
+	}
+
+	if err := json.Unmarshal([]byte(`[1]`), decoded); err == nil {
+		t.Error("Unmarshal failed: expected codec error for plain integer")
 	}
 }
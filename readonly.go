@@ -0,0 +1,46 @@
+package orderedset
+
+import "iter"
+
+// ReadOnlyView is a read-only wrapper around an OrderedSet.
+// It shares the underlying storage and lock with the set it was created from,
+// so changes made to that set are visible through the view.
+type ReadOnlyView[T comparable] struct {
+	set *OrderedSet[T]
+}
+
+// ReadOnly returns a read-only view of the set.
+// The view does not copy the set: the set itself can still change beneath it.
+func (s *OrderedSet[T]) ReadOnly() ReadOnlyView[T] {
+	return ReadOnlyView[T]{set: s}
+}
+
+// Has reports whether the underlying set contains the given value.
+func (v ReadOnlyView[T]) Has(value T) bool {
+	return v.set.Has(value)
+}
+
+// Len returns the number of elements in the underlying set.
+func (v ReadOnlyView[T]) Len() int {
+	return v.set.Len()
+}
+
+// At returns the element at the given index.
+func (v ReadOnlyView[T]) At(index int) (T, bool) {
+	return v.set.At(index)
+}
+
+// IndexOf returns the index of the given value, or -1 if not found.
+func (v ReadOnlyView[T]) IndexOf(value T) int {
+	return v.set.IndexOf(value)
+}
+
+// Values returns a copy of the values in insertion order.
+func (v ReadOnlyView[T]) Values() []T {
+	return v.set.Values()
+}
+
+// Enumerate returns an iterator over index-value pairs of a snapshot of the underlying set.
+func (v ReadOnlyView[T]) Enumerate() iter.Seq2[int, T] {
+	return v.set.Enumerate()
+}
@@ -0,0 +1,39 @@
+package orderedset_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/babenkoivan/orderedset"
+)
+
+func TestReadOnly(t *testing.T) {
+	s := orderedset.New[int]()
+	s.Add(1)
+	s.Add(2)
+
+	view := s.ReadOnly()
+	if !view.Has(1) || view.Len() != 2 || view.IndexOf(2) != 1 {
+		t.Error("ReadOnly failed: view does not reflect the set")
+	}
+	if v, ok := view.At(0); !ok || v != 1 {
+		t.Errorf("ReadOnly failed: At(0) got (%v, %v), want (1, true)", v, ok)
+	}
+
+	s.Add(3)
+	expected := []int{1, 2, 3}
+	if !reflect.DeepEqual(view.Values(), expected) {
+		t.Errorf("ReadOnly failed: got %v, want %v", view.Values(), expected)
+	}
+
+	var got []int
+	for i, v := range view.Enumerate() {
+		if i != len(got) {
+			t.Errorf("Enumerate failed: got index %d, want %d", i, len(got))
+		}
+		got = append(got, v)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Enumerate failed: got %v, want %v", got, expected)
+	}
+}
@@ -0,0 +1,113 @@
+package orderedset
+
+import (
+	"cmp"
+	"hash/maphash"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedOrderedSet is a goroutine-safe ordered set that spreads its elements over several
+// independently locked shards, chosen by hashing each element, so that concurrent Add, Has
+// and Remove calls on different elements rarely wait for each other.
+//
+// Each element records a global sequence number taken when it is added, and Values returns
+// the elements ordered by it. Values locks the shards one after the other rather than all at
+// once, so under concurrent mutation it may reflect a change to one shard but not a change
+// made at the same time to another. Without concurrent mutation, the result is exact.
+type ShardedOrderedSet[T comparable] struct {
+	seed   maphash.Seed
+	seq    atomic.Uint64
+	shards []shard[T]
+}
+
+// shard holds the elements of a ShardedOrderedSet that hash to it, with their sequence numbers.
+type shard[T comparable] struct {
+	mu   sync.RWMutex
+	seqs map[T]uint64
+}
+
+// NewSharded creates a new empty ShardedOrderedSet with the given number of shards.
+// A count of zero or less uses a single shard.
+func NewSharded[T comparable](shards int) *ShardedOrderedSet[T] {
+	s := &ShardedOrderedSet[T]{
+		seed:   maphash.MakeSeed(),
+		shards: make([]shard[T], max(shards, 1)),
+	}
+	for i := range s.shards {
+		s.shards[i].seqs = make(map[T]uint64)
+	}
+	return s
+}
+
+// shardFor returns the shard holding value.
+func (s *ShardedOrderedSet[T]) shardFor(value T) *shard[T] {
+	h := maphash.Comparable(s.seed, value)
+	return &s.shards[h%uint64(len(s.shards))]
+}
+
+// Add inserts a value into the set if it is not already present.
+func (s *ShardedOrderedSet[T]) Add(value T) {
+	sh := s.shardFor(value)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, exists := sh.seqs[value]; !exists {
+		sh.seqs[value] = s.seq.Add(1)
+	}
+}
+
+// Remove deletes a value from the set.
+func (s *ShardedOrderedSet[T]) Remove(value T) {
+	sh := s.shardFor(value)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	delete(sh.seqs, value)
+}
+
+// Has reports whether the set contains the given value.
+func (s *ShardedOrderedSet[T]) Has(value T) bool {
+	sh := s.shardFor(value)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	_, exists := sh.seqs[value]
+	return exists
+}
+
+// Len returns the number of elements in the set, summed over the shards one at a time.
+func (s *ShardedOrderedSet[T]) Len() int {
+	var n int
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		n += len(sh.seqs)
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// Values returns the values in insertion order. It costs O(n log n), since the elements of
+// all shards are gathered and sorted by sequence number.
+func (s *ShardedOrderedSet[T]) Values() []T {
+	type entry struct {
+		seq   uint64
+		value T
+	}
+	var entries []entry
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for v, seq := range sh.seqs {
+			entries = append(entries, entry{seq: seq, value: v})
+		}
+		sh.mu.RUnlock()
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	values := make([]T, len(entries))
+	for i, e := range entries {
+		values[i] = e.value
+	}
+	return values
+}
@@ -0,0 +1,84 @@
+package orderedset_test
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/babenkoivan/orderedset"
+)
+
+func TestNewSharded(t *testing.T) {
+	s := orderedset.NewSharded[string](8)
+	for i := range 100 {
+		s.Add(strconv.Itoa(i))
+	}
+	s.Add("0")
+	s.Remove("50")
+
+	if s.Len() != 99 {
+		t.Errorf("NewSharded failed: got length %d, want 99", s.Len())
+	}
+	if !s.Has("99") || s.Has("50") {
+		t.Error("NewSharded failed: unexpected membership after Remove")
+	}
+
+	expected := make([]string, 0, 99)
+	for i := range 100 {
+		if i != 50 {
+			expected = append(expected, strconv.Itoa(i))
+		}
+	}
+	if !reflect.DeepEqual(s.Values(), expected) {
+		t.Errorf("NewSharded failed: got %v, want %v", s.Values(), expected)
+	}
+}
+
+func TestShardedConcurrent(t *testing.T) {
+	s := orderedset.NewSharded[int](4)
+
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 250 {
+				s.Add(g*250 + i)
+				s.Has(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if l := len(s.Values()); l != 1000 || s.Len() != 1000 {
+		t.Errorf("ShardedOrderedSet failed: got %d values and length %d, want 1000", l, s.Len())
+	}
+}
+
+func BenchmarkConcurrentAddHas(b *testing.B) {
+	plain := orderedset.New[int]()
+	sharded := orderedset.NewSharded[int](32)
+
+	for n, set := range map[string]interface {
+		Add(int)
+		Has(int) bool
+	}{
+		"OrderedSet":        plain,
+		"ShardedOrderedSet": sharded,
+	} {
+		b.Run(n, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					if i%8 == 0 {
+						set.Add(i % 4096)
+					} else {
+						set.Has(i % 4096)
+					}
+					i++
+				}
+			})
+		})
+	}
+}